@@ -0,0 +1,289 @@
+// Package archetypes defines the types of faction players can create and the bonuses each
+// gives. Archetypes are read from a YAML or JSON file so designers can add and tune them
+// without rebuilding the server; the built-in Defaults are used when no file is configured.
+//
+// The file is a list of archetypes; config/factions.yaml holds the defaults in that format.
+package archetypes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"drokkit/economy"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Limits on archetype values
+const (
+	MaxNameLength    = 64 // Matches the size of the Faction faction_type column
+	MaxMultiplier    = 5
+	MaxStartingUnits = 10000
+)
+
+// ErrInvalid is returned for archetypes that cannot be decoded or fail validation.
+var ErrInvalid = errors.New("invalid archetypes")
+
+// Archetype is a type of faction and the bonuses its factions get.
+type Archetype struct {
+	Name            string  `json:"name" yaml:"name"`
+	ResourceBonus   float64 `json:"resource_bonus" yaml:"resource_bonus"`
+	CombatBonus     float64 `json:"combat_bonus" yaml:"combat_bonus"`
+	BuildingSpeed   float64 `json:"building_speed" yaml:"building_speed"`
+	ResearchSpeed   float64 `json:"research_speed" yaml:"research_speed"`
+	TradeRate       float64 `json:"trade_rate" yaml:"trade_rate"`
+	DefenseStrength float64 `json:"defense_strength" yaml:"defense_strength"`
+	StartingUnits   int     `json:"starting_units" yaml:"starting_units"`
+}
+
+// Defaults are the archetypes used when no file is configured.
+var Defaults = []Archetype{
+	{Name: "Industrialists", ResourceBonus: 1.2, CombatBonus: 0.8, BuildingSpeed: 1.5, ResearchSpeed: 1.0, TradeRate: 1.0, DefenseStrength: 1.0, StartingUnits: 100},
+	{Name: "Warriors", ResourceBonus: 0.8, CombatBonus: 1.5, BuildingSpeed: 1.0, ResearchSpeed: 1.0, TradeRate: 1.0, DefenseStrength: 1.2, StartingUnits: 100},
+	{Name: "Technologists", ResourceBonus: 1.0, CombatBonus: 1.0, BuildingSpeed: 1.0, ResearchSpeed: 1.5, TradeRate: 1.0, DefenseStrength: 1.0, StartingUnits: 100},
+	{Name: "Traders", ResourceBonus: 1.0, CombatBonus: 0.8, BuildingSpeed: 1.0, ResearchSpeed: 1.0, TradeRate: 1.5, DefenseStrength: 0.8, StartingUnits: 100},
+}
+
+// Validate checks a set of archetypes: there must be at least one, names must be unique,
+// every multiplier must be above 0 and at most MaxMultiplier, and starting units must be
+// between 0 and MaxStartingUnits. The trade rate must also be at least
+// economy.BaseTradeFee, since a lower rate makes trade fees larger than the amount traded.
+func Validate(list []Archetype) error {
+	if len(list) == 0 {
+		return fmt.Errorf("%w: at least one archetype is required", ErrInvalid)
+	}
+
+	seen := make(map[string]bool, len(list))
+	for i, archetype := range list {
+		name := strings.TrimSpace(archetype.Name)
+		if name == "" || name != archetype.Name || len(name) > MaxNameLength {
+			return fmt.Errorf("%w: archetype %d: name must be 1 to %d characters without surrounding spaces", ErrInvalid, i+1, MaxNameLength)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: archetype %q is defined more than once", ErrInvalid, name)
+		}
+		seen[name] = true
+
+		multipliers := []struct {
+			field string
+			value float64
+		}{
+			{"resource_bonus", archetype.ResourceBonus},
+			{"combat_bonus", archetype.CombatBonus},
+			{"building_speed", archetype.BuildingSpeed},
+			{"research_speed", archetype.ResearchSpeed},
+			{"trade_rate", archetype.TradeRate},
+			{"defense_strength", archetype.DefenseStrength},
+		}
+		for _, multiplier := range multipliers {
+			if !(multiplier.value > 0 && multiplier.value <= MaxMultiplier) {
+				return fmt.Errorf("%w: archetype %q: %s must be above 0 and at most %d", ErrInvalid, name, multiplier.field, MaxMultiplier)
+			}
+		}
+		if archetype.TradeRate < economy.BaseTradeFee {
+			return fmt.Errorf("%w: archetype %q: trade_rate must be at least %v", ErrInvalid, name, economy.BaseTradeFee)
+		}
+		if archetype.StartingUnits < 0 || archetype.StartingUnits > MaxStartingUnits {
+			return fmt.Errorf("%w: archetype %q: starting_units must be between 0 and %d", ErrInvalid, name, MaxStartingUnits)
+		}
+	}
+	return nil
+}
+
+// isYAML reports whether a file holds YAML rather than JSON, going by its extension.
+func isYAML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// Parse decodes and validates archetypes in YAML or JSON. Unknown fields are rejected so
+// that misspelt bonuses are not silently ignored.
+func Parse(data []byte, asYAML bool) ([]Archetype, error) {
+	var list []Archetype
+	if asYAML {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&list); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&list); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	return list, Validate(list)
+}
+
+// Registry holds the current archetypes and the file they were read from, if any. It is
+// safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	path       string
+	modTime    time.Time // Modification time of the file when it was last read
+	archetypes []Archetype
+}
+
+// DefaultRegistry returns a registry holding the Defaults, without a file.
+func DefaultRegistry() *Registry {
+	return &Registry{archetypes: Defaults}
+}
+
+// NewRegistry reads archetypes from a YAML or JSON file, chosen by its extension.
+func NewRegistry(path string) (*Registry, error) {
+	registry := &Registry{path: path}
+	if err := registry.Reload(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Path returns the file the archetypes are read from, or "" if there is none.
+func (r *Registry) Path() string {
+	return r.path
+}
+
+// Get returns the archetype with the given name.
+func (r *Registry) Get(name string) (Archetype, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, archetype := range r.archetypes {
+		if archetype.Name == name {
+			return archetype, true
+		}
+	}
+	return Archetype{}, false
+}
+
+// All returns every archetype, in the order they are defined.
+func (r *Registry) All() []Archetype {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Archetype(nil), r.archetypes...)
+}
+
+// Reload reads the file again. If it cannot be read or is invalid the current archetypes
+// are kept.
+func (r *Registry) Reload() error {
+	if r.path == "" {
+		return errors.New("no archetype file is configured")
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	list, err := Parse(data, isYAML(r.path))
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.archetypes = list
+	r.modTime = info.ModTime()
+	return nil
+}
+
+// ReloadIfChanged reads the file again if it was modified since it was last read, and
+// reports whether it did. A file that fails to load is not retried until it changes again.
+func (r *Registry) ReloadIfChanged() (bool, error) {
+	if r.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := info.ModTime().Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	if err := r.Reload(); err != nil {
+		r.mu.Lock()
+		r.modTime = info.ModTime()
+		r.mu.Unlock()
+		return true, err
+	}
+	return true, nil
+}
+
+// Replace validates and swaps in a new set of archetypes. When the registry has a file the
+// archetypes are written to it first, so they survive a restart.
+func (r *Registry) Replace(list []Archetype) error {
+	if err := Validate(list); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.path != "" {
+		modTime, err := write(r.path, list)
+		if err != nil {
+			return err
+		}
+		r.modTime = modTime
+	}
+	r.archetypes = append([]Archetype(nil), list...)
+	return nil
+}
+
+// write saves archetypes to a file in its format, replacing it in one step so a reload
+// never sees a partly written file. It returns the file's new modification time.
+func write(path string, list []Archetype) (time.Time, error) {
+	var data []byte
+	var err error
+	if isYAML(path) {
+		data, err = yaml.Marshal(list)
+	} else {
+		data, err = json.MarshalIndent(list, "", "  ")
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer os.Remove(tmp.Name())
+	// Keep the permissions of the file being replaced
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			return time.Time{}, err
+		}
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return time.Time{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return time.Time{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,227 @@
+package archetypes
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"drokkit/economy"
+)
+
+func validArchetype(name string) Archetype {
+	return Archetype{Name: name, ResourceBonus: 1, CombatBonus: 1, BuildingSpeed: 1, ResearchSpeed: 1, TradeRate: 1, DefenseStrength: 1, StartingUnits: 100}
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	if err := Validate(Defaults); err != nil {
+		t.Errorf("Validate(Defaults): %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(list []Archetype) []Archetype
+	}{
+		{"empty", func(list []Archetype) []Archetype { return nil }},
+		{"duplicate name", func(list []Archetype) []Archetype { return append(list, validArchetype("Miners")) }},
+		{"blank name", func(list []Archetype) []Archetype { list[0].Name = "  "; return list }},
+		{"leading space", func(list []Archetype) []Archetype { list[0].Name = " Miners"; return list }},
+		{"trailing space", func(list []Archetype) []Archetype { list[0].Name = "Miners "; return list }},
+		{"name too long", func(list []Archetype) []Archetype { list[0].Name = strings.Repeat("a", MaxNameLength+1); return list }},
+		{"zero multiplier", func(list []Archetype) []Archetype { list[0].CombatBonus = 0; return list }},
+		{"negative multiplier", func(list []Archetype) []Archetype { list[1].TradeRate = -1; return list }},
+		{"trade rate below the base fee", func(list []Archetype) []Archetype { list[0].TradeRate = economy.BaseTradeFee / 2; return list }},
+		{"multiplier above the maximum", func(list []Archetype) []Archetype { list[1].ResearchSpeed = MaxMultiplier + 0.1; return list }},
+		{"negative starting units", func(list []Archetype) []Archetype { list[0].StartingUnits = -1; return list }},
+		{"too many starting units", func(list []Archetype) []Archetype { list[0].StartingUnits = MaxStartingUnits + 1; return list }},
+	}
+	for _, test := range tests {
+		list := test.modify([]Archetype{validArchetype("Miners"), validArchetype("Sailors")})
+		if err := Validate(list); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Validate error = %v, want ErrInvalid", test.name, err)
+		}
+	}
+
+	edges := []Archetype{validArchetype("Miners"), validArchetype("Sailors")}
+	edges[0].DefenseStrength = MaxMultiplier
+	edges[0].TradeRate = economy.BaseTradeFee
+	edges[0].StartingUnits = 0
+	edges[1].StartingUnits = MaxStartingUnits
+	if err := Validate(edges); err != nil {
+		t.Errorf("Validate at the limits: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	yamlList := `
+- name: Miners
+  resource_bonus: 1.3
+  combat_bonus: 1
+  building_speed: 1
+  research_speed: 1
+  trade_rate: 1
+  defense_strength: 1
+  starting_units: 80
+`
+	jsonList := `[{"name": "Miners", "resource_bonus": 1.3, "combat_bonus": 1, "building_speed": 1,
+		"research_speed": 1, "trade_rate": 1, "defense_strength": 1, "starting_units": 80}]`
+	want := validArchetype("Miners")
+	want.ResourceBonus = 1.3
+	want.StartingUnits = 80
+
+	for _, test := range []struct {
+		format string
+		data   string
+		asYAML bool
+	}{
+		{"YAML", yamlList, true},
+		{"JSON", jsonList, false},
+	} {
+		list, err := Parse([]byte(test.data), test.asYAML)
+		if err != nil {
+			t.Errorf("Parse %s: %v", test.format, err)
+		} else if len(list) != 1 || list[0] != want {
+			t.Errorf("Parse %s = %+v, want [%+v]", test.format, list, want)
+		}
+	}
+
+	invalid := []struct {
+		name   string
+		data   string
+		asYAML bool
+	}{
+		{"unknown YAML field", strings.Replace(yamlList, "combat_bonus", "combat_bonsu", 1), true},
+		{"unknown JSON field", strings.Replace(jsonList, "combat_bonus", "combat_bonsu", 1), false},
+		{"malformed YAML", "- name: [", true},
+		{"malformed JSON", "[{", false},
+		{"invalid archetype", strings.Replace(jsonList, `"trade_rate": 1`, `"trade_rate": 9`, 1), false},
+	}
+	for _, test := range invalid {
+		if _, err := Parse([]byte(test.data), test.asYAML); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Parse error = %v, want ErrInvalid", test.name, err)
+		}
+	}
+}
+
+// writeFile writes archetypes to a file with the given modification time, so changes are
+// seen even on file systems with coarse timestamps.
+func writeFile(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+func names(list []Archetype) string {
+	parts := make([]string, len(list))
+	for i, archetype := range list {
+		parts[i] = archetype.Name
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestRegistryReloadIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "factions.json")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeFile(t, path, `[{"name": "Miners", "resource_bonus": 1, "combat_bonus": 1, "building_speed": 1, "research_speed": 1, "trade_rate": 1, "defense_strength": 1}]`, start)
+
+	registry, err := NewRegistry(path)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	if got := names(registry.All()); got != "Miners" {
+		t.Fatalf("archetypes = %s, want Miners", got)
+	}
+	if reloaded, err := registry.ReloadIfChanged(); reloaded || err != nil {
+		t.Errorf("ReloadIfChanged of an unchanged file = %v, %v, want false, nil", reloaded, err)
+	}
+
+	// A bad file is reported once and the current archetypes are kept
+	writeFile(t, path, `[{"name": "Sailors", "trade_rate": 1}]`, start.Add(time.Minute))
+	if reloaded, err := registry.ReloadIfChanged(); !reloaded || !errors.Is(err, ErrInvalid) {
+		t.Errorf("ReloadIfChanged of a bad file = %v, %v, want true, ErrInvalid", reloaded, err)
+	}
+	if got := names(registry.All()); got != "Miners" {
+		t.Errorf("archetypes after a bad file = %s, want Miners", got)
+	}
+	if _, ok := registry.Get("Miners"); !ok {
+		t.Error("Get(Miners) failed after a bad file")
+	}
+	if reloaded, err := registry.ReloadIfChanged(); reloaded || err != nil {
+		t.Errorf("ReloadIfChanged retried a bad file that did not change: %v, %v", reloaded, err)
+	}
+
+	// Fixing the file loads it
+	writeFile(t, path, `[{"name": "Sailors", "resource_bonus": 1, "combat_bonus": 1, "building_speed": 1, "research_speed": 1, "trade_rate": 2, "defense_strength": 1}]`, start.Add(2*time.Minute))
+	if reloaded, err := registry.ReloadIfChanged(); !reloaded || err != nil {
+		t.Errorf("ReloadIfChanged of a fixed file = %v, %v, want true, nil", reloaded, err)
+	}
+	if sailors, ok := registry.Get("Sailors"); !ok || sailors.TradeRate != 2 {
+		t.Errorf("Get(Sailors) = %+v, %v after reloading", sailors, ok)
+	}
+	if _, ok := registry.Get("Miners"); ok {
+		t.Error("Miners is still defined after reloading a file without it")
+	}
+}
+
+func TestRegistryReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "factions.yaml")
+	writeFile(t, path, "- name: Miners\n  resource_bonus: 1\n  combat_bonus: 1\n  building_speed: 1\n  research_speed: 1\n  trade_rate: 1\n  defense_strength: 1\n", time.Now().Add(-time.Hour))
+	registry, err := NewRegistry(path)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	if err := registry.Replace([]Archetype{validArchetype("Miners"), validArchetype("Miners")}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Replace with duplicates error = %v, want ErrInvalid", err)
+	}
+	if err := registry.Replace([]Archetype{validArchetype("Sailors")}); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if got := names(registry.All()); got != "Sailors" {
+		t.Errorf("archetypes after Replace = %s, want Sailors", got)
+	}
+	// The registry's own write is not picked up as a change
+	if reloaded, err := registry.ReloadIfChanged(); reloaded || err != nil {
+		t.Errorf("ReloadIfChanged after Replace = %v, %v, want false, nil", reloaded, err)
+	}
+
+	// and the file holds the new archetypes
+	reread, err := NewRegistry(path)
+	if err != nil {
+		t.Fatalf("NewRegistry after Replace: %v", err)
+	}
+	if got := names(reread.All()); got != "Sailors" {
+		t.Errorf("file holds %s after Replace, want Sailors", got)
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	registry := DefaultRegistry()
+	if len(registry.All()) != len(Defaults) {
+		t.Errorf("DefaultRegistry holds %d archetypes, want %d", len(registry.All()), len(Defaults))
+	}
+	if reloaded, err := registry.ReloadIfChanged(); reloaded || err != nil {
+		t.Errorf("ReloadIfChanged without a file = %v, %v, want false, nil", reloaded, err)
+	}
+	if err := registry.Reload(); err == nil {
+		t.Error("Reload without a file did not fail")
+	}
+}
+
+func TestShippedFile(t *testing.T) {
+	registry, err := NewRegistry(filepath.Join("..", "config", "factions.yaml"))
+	if err != nil {
+		t.Fatalf("config/factions.yaml: %v", err)
+	}
+	if got, want := names(registry.All()), names(Defaults); got != want {
+		t.Errorf("config/factions.yaml defines %s, want the defaults %s", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+// Package combat resolves battles between factions.
+//
+// A battle is fought in rounds. Each round both sides roll a die, scaled by the
+// attacker's combat bonus and the defender's defense strength, and the side with the
+// lower score loses a share of its units. The battle ends when a side has no units left
+// or the round limit is reached. All randomness comes from the Roller, so a battle
+// fought with the same rolls always has the same result.
+package combat
+
+import (
+	"fmt"
+	"math"
+)
+
+// Outcomes, matching the CombatLog outcome enum
+const (
+	AttackerWins = "Attacker Wins"
+	DefenderWins = "Defender Wins"
+	Draw         = "Draw"
+)
+
+// Battle tuning
+const (
+	DieSides      = 20  // Sides of the die each side rolls per round
+	MaxRounds     = 10  // Rounds fought before the battle is called a draw
+	CasualtyRate  = 0.1 // Share of the winning side's units the losing side loses per round
+	MinCasualties = 1   // Fewest units lost by the side that loses a round
+)
+
+// Roller makes the die rolls for a battle. purpose describes what the roll decides, so it
+// can be recorded and replayed.
+type Roller interface {
+	Roll(purpose string, sides int) (int, error)
+}
+
+// Side is one side of a battle.
+type Side struct {
+	Units    int     // Units committed to the battle
+	Modifier float64 // Combat bonus for the attacker, defense strength for the defender
+}
+
+// Round is what happened in one round of a battle.
+type Round struct {
+	Round          int     `json:"round"` // 1-based
+	AttackerRoll   int     `json:"attacker_roll"`
+	DefenderRoll   int     `json:"defender_roll"`
+	AttackerScore  float64 `json:"attacker_score"`
+	DefenderScore  float64 `json:"defender_score"`
+	AttackerLosses int     `json:"attacker_losses"`
+	DefenderLosses int     `json:"defender_losses"`
+	AttackerUnits  int     `json:"attacker_units"` // Units left after the round
+	DefenderUnits  int     `json:"defender_units"`
+}
+
+// Result is the outcome of a battle.
+type Result struct {
+	Outcome        string
+	AttackerLosses int
+	DefenderLosses int
+	Rounds         []Round
+}
+
+// Resolve fights a battle between the attacker and the defender. prefix is prepended to
+// the purpose of every roll. A defender without units loses without a fight.
+func Resolve(roller Roller, prefix string, attacker, defender Side) (Result, error) {
+	var result Result
+	attackers, defenders := attacker.Units, defender.Units
+
+	for round := 1; round <= MaxRounds && attackers > 0 && defenders > 0; round++ {
+		attackRoll, err := roller.Roll(fmt.Sprintf("%s:round:%d:attacker", prefix, round), DieSides)
+		if err != nil {
+			return result, err
+		}
+		defenseRoll, err := roller.Roll(fmt.Sprintf("%s:round:%d:defender", prefix, round), DieSides)
+		if err != nil {
+			return result, err
+		}
+
+		r := Round{
+			Round:         round,
+			AttackerRoll:  attackRoll,
+			DefenderRoll:  defenseRoll,
+			AttackerScore: float64(attackRoll) * attacker.Modifier,
+			DefenderScore: float64(defenseRoll) * defender.Modifier,
+		}
+		switch {
+		case r.AttackerScore > r.DefenderScore:
+			r.DefenderLosses = casualties(attackers, defenders)
+		case r.AttackerScore < r.DefenderScore:
+			r.AttackerLosses = casualties(defenders, attackers)
+		default:
+			r.AttackerLosses = MinCasualties
+			r.DefenderLosses = MinCasualties
+		}
+
+		attackers -= r.AttackerLosses
+		defenders -= r.DefenderLosses
+		r.AttackerUnits, r.DefenderUnits = attackers, defenders
+		result.Rounds = append(result.Rounds, r)
+	}
+
+	result.AttackerLosses = attacker.Units - attackers
+	result.DefenderLosses = defender.Units - defenders
+	switch {
+	case defenders == 0 && attackers > 0:
+		result.Outcome = AttackerWins
+	case attackers == 0 && defenders > 0:
+		result.Outcome = DefenderWins
+	default:
+		result.Outcome = Draw
+	}
+	return result, nil
+}
+
+// casualties returns how many units the losing side of a round loses to a winning side
+// of the given size, never more than it has.
+func casualties(winners, losers int) int {
+	lost := int(math.Ceil(float64(winners) * CasualtyRate))
+	if lost < MinCasualties {
+		lost = MinCasualties
+	}
+	if lost > losers {
+		lost = losers
+	}
+	return lost
+}
@@ -0,0 +1,149 @@
+package combat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fixedRoller rolls the same value for a side every round and records each roll's purpose.
+type fixedRoller struct {
+	attack, defense int
+	purposes        []string
+}
+
+func (r *fixedRoller) Roll(purpose string, sides int) (int, error) {
+	r.purposes = append(r.purposes, purpose)
+	if strings.HasSuffix(purpose, ":attacker") {
+		return r.attack, nil
+	}
+	return r.defense, nil
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name               string
+		attack, defense    int // Rolls made every round
+		attacker, defender Side
+		outcome            string
+		attackerLosses     int
+		defenderLosses     int
+		rounds             int
+	}{
+		{
+			name:   "attacker wins",
+			attack: 15, defense: 5,
+			attacker: Side{Units: 10, Modifier: 1}, defender: Side{Units: 2, Modifier: 1},
+			outcome: AttackerWins, attackerLosses: 0, defenderLosses: 2, rounds: 2,
+		},
+		{
+			name:   "defender holds",
+			attack: 5, defense: 15,
+			attacker: Side{Units: 5, Modifier: 1}, defender: Side{Units: 30, Modifier: 1},
+			outcome: DefenderWins, attackerLosses: 5, defenderLosses: 0, rounds: 2,
+		},
+		{
+			name:   "casualties are a tenth of the winning side, rounded up",
+			attack: 15, defense: 5,
+			attacker: Side{Units: 25, Modifier: 1}, defender: Side{Units: 7, Modifier: 1},
+			outcome: AttackerWins, attackerLosses: 0, defenderLosses: 7, rounds: 3,
+		},
+		{
+			name:   "combat bonus turns a lower roll into a win",
+			attack: 10, defense: 12,
+			attacker: Side{Units: 10, Modifier: 1.5}, defender: Side{Units: 1, Modifier: 1},
+			outcome: AttackerWins, attackerLosses: 0, defenderLosses: 1, rounds: 1,
+		},
+		{
+			name:   "defense strength turns a lower roll into a win",
+			attack: 12, defense: 10,
+			attacker: Side{Units: 1, Modifier: 1}, defender: Side{Units: 10, Modifier: 1.3},
+			outcome: DefenderWins, attackerLosses: 1, defenderLosses: 0, rounds: 1,
+		},
+		{
+			name:   "equal scores cost both sides a unit",
+			attack: 12, defense: 8,
+			attacker: Side{Units: 1, Modifier: 1}, defender: Side{Units: 1, Modifier: 1.5},
+			outcome: Draw, attackerLosses: 1, defenderLosses: 1, rounds: 1,
+		},
+		{
+			name:   "draw at the round limit",
+			attack: 10, defense: 10,
+			attacker: Side{Units: 100, Modifier: 1}, defender: Side{Units: 100, Modifier: 1},
+			outcome: Draw, attackerLosses: MaxRounds, defenderLosses: MaxRounds, rounds: MaxRounds,
+		},
+		{
+			name:   "defender without units loses without a fight",
+			attack: 1, defense: 20,
+			attacker: Side{Units: 10, Modifier: 1}, defender: Side{Units: 0, Modifier: 1},
+			outcome: AttackerWins, rounds: 0,
+		},
+		{
+			name:   "attacker without units loses without a fight",
+			attack: 20, defense: 1,
+			attacker: Side{Units: 0, Modifier: 1}, defender: Side{Units: 10, Modifier: 1},
+			outcome: DefenderWins, rounds: 0,
+		},
+		{
+			name:   "no units on either side",
+			attack: 20, defense: 1,
+			attacker: Side{Units: 0, Modifier: 1}, defender: Side{Units: 0, Modifier: 1},
+			outcome: Draw, rounds: 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roller := &fixedRoller{attack: test.attack, defense: test.defense}
+			result, err := Resolve(roller, "combat:1", test.attacker, test.defender)
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if result.Outcome != test.outcome {
+				t.Errorf("Outcome = %q, want %q", result.Outcome, test.outcome)
+			}
+			if result.AttackerLosses != test.attackerLosses || result.DefenderLosses != test.defenderLosses {
+				t.Errorf("losses = %d/%d, want %d/%d", result.AttackerLosses, result.DefenderLosses, test.attackerLosses, test.defenderLosses)
+			}
+			if len(result.Rounds) != test.rounds {
+				t.Fatalf("fought %d rounds, want %d", len(result.Rounds), test.rounds)
+			}
+			if len(roller.purposes) != 2*test.rounds {
+				t.Errorf("made %d rolls, want %d", len(roller.purposes), 2*test.rounds)
+			}
+
+			// Each round's units follow from the previous round's losses
+			attackers, defenders := test.attacker.Units, test.defender.Units
+			for i, round := range result.Rounds {
+				attackers -= round.AttackerLosses
+				defenders -= round.DefenderLosses
+				if round.Round != i+1 || round.AttackerUnits != attackers || round.DefenderUnits != defenders {
+					t.Errorf("round %d = %+v, want %d attackers and %d defenders left", i+1, round, attackers, defenders)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveRollPurposes(t *testing.T) {
+	roller := &fixedRoller{attack: 15, defense: 5}
+	if _, err := Resolve(roller, "combat:7", Side{Units: 10, Modifier: 1}, Side{Units: 1, Modifier: 1}); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := []string{"combat:7:round:1:attacker", "combat:7:round:1:defender"}
+	if strings.Join(roller.purposes, ",") != strings.Join(want, ",") {
+		t.Errorf("roll purposes = %v, want %v", roller.purposes, want)
+	}
+}
+
+// failingRoller fails every roll.
+type failingRoller struct{}
+
+func (failingRoller) Roll(purpose string, sides int) (int, error) {
+	return 0, errors.New("out of draws")
+}
+
+func TestResolveRollerError(t *testing.T) {
+	if _, err := Resolve(failingRoller{}, "combat:1", Side{Units: 5, Modifier: 1}, Side{Units: 5, Modifier: 1}); err == nil {
+		t.Error("Resolve did not return the roller's error")
+	}
+}
@@ -63,14 +63,29 @@ func InitDatabase(inMemory bool) (*gorm.DB, *sql.DB) {
 	err = db.AutoMigrate(
 		&models.Player{},
 		&models.Stats{},
+		&models.Rating{},
+		&models.RatingHistory{},
+		&models.Season{},
+		&models.SeasonStanding{},
+		&models.SeasonStats{},
 		&models.Match{},
 		&models.GameInstance{},
+		&models.GameInstancePlayer{},
+		&models.RandomDraw{},
+		&models.Lobby{},
+		&models.LobbyMember{},
+		&models.LobbyChat{},
 		&models.Faction{},
 		&models.FactionMember{},
 		&models.Alliance{},
 		&models.AllianceMember{},
 		&models.AllianceChat{},
 		&models.Resource{},
+		&models.ResourceLedger{},
+		&models.TradeOffer{},
+		&models.MarketOrder{},
+		&models.MarketTrade{},
+		&models.Project{},
 		&models.CombatLog{},
 		&models.CombatEvent{},
 		&models.VictoryCondition{},
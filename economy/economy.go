@@ -0,0 +1,58 @@
+// Package economy defines the resources players collect in a game instance and how much
+// of each they produce.
+package economy
+
+import "math"
+
+// Resource types
+const (
+	Gold  = "Gold"
+	Wood  = "Wood"
+	Stone = "Stone"
+	Food  = "Food"
+)
+
+// Kind describes a type of resource.
+type Kind struct {
+	Type       string `json:"type"`
+	Starting   int    `json:"starting"`   // Amount each player starts a game with
+	Production int    `json:"production"` // Amount each player produces per tick, before bonuses
+}
+
+// Catalog lists every type of resource.
+var Catalog = []Kind{
+	{Type: Gold, Starting: 100, Production: 10},
+	{Type: Wood, Starting: 50, Production: 15},
+	{Type: Stone, Starting: 50, Production: 8},
+	{Type: Food, Starting: 100, Production: 20},
+}
+
+// Lookup returns the kind of resource with the given type.
+func Lookup(resourceType string) (Kind, bool) {
+	for _, kind := range Catalog {
+		if kind.Type == resourceType {
+			return kind, true
+		}
+	}
+	return Kind{}, false
+}
+
+// Produced returns how much of a resource a player with the given resource bonus
+// produces in one tick.
+func Produced(kind Kind, bonus float64) int {
+	return int(math.Round(float64(kind.Production) * bonus))
+}
+
+// BaseTradeFee is the share of what a player receives in a trade that is lost as a fee,
+// before their faction's trade rate is applied.
+const BaseTradeFee = 0.1
+
+// TradeFee returns the fee taken from an amount received in a trade by a player with the
+// given trade rate. A higher trade rate means a lower fee; players without a trade rate
+// pay the base fee.
+func TradeFee(amount int, tradeRate float64) int {
+	if tradeRate <= 0 {
+		tradeRate = 1
+	}
+	return int(math.Round(float64(amount) * BaseTradeFee / tradeRate))
+}
@@ -2,18 +2,67 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"drokkit/models"
+	"gorm.io/gorm"
 	"time"
 )
 
-// CreateAdmin allows the creation of admin users. This should be restricted and possibly handled offline.
+const adminContextKey contextKey = "admin"
+
+// WithAdmin loads the admin record of the authenticated player into the context.
+// It fails if the player is not an admin.
+func WithAdmin(ctx context.Context) (context.Context, error) {
+	player, ok := PlayerFromContext(ctx)
+	if !ok {
+		return ctx, errors.New("not authenticated")
+	}
+
+	var admin models.Admin
+	if err := db.Where("user_id = ?", player.ID).First(&admin).Error; err != nil {
+		return ctx, errors.New("not an admin")
+	}
+	return context.WithValue(ctx, adminContextKey, admin), nil
+}
+
+// AdminFromContext returns the admin record stored in the context by WithAdmin.
+func AdminFromContext(ctx context.Context) (models.Admin, bool) {
+	admin, ok := ctx.Value(adminContextKey).(models.Admin)
+	return admin, ok
+}
+
+// BootstrapAdmin grants every permission to the named player. It is meant to be run
+// offline to create the first admin, since only admins can create other admins.
+func BootstrapAdmin(database *gorm.DB, username string) (models.Admin, error) {
+	var player models.Player
+	if err := database.Where("username = ?", username).First(&player).Error; err != nil {
+		return models.Admin{}, fmt.Errorf("player %q not found: %w", username, err)
+	}
+
+	var admin models.Admin
+	if err := database.Where(models.Admin{UserID: player.ID}).FirstOrInit(&admin).Error; err != nil {
+		return models.Admin{}, err
+	}
+	admin.Permissions = models.AllPermissions
+	admin.AssignedAt = time.Now()
+
+	if err := database.Save(&admin).Error; err != nil {
+		return models.Admin{}, err
+	}
+	return admin, nil
+}
+
+// CreateAdmin allows admins to grant admin permissions to another player. Callers can
+// only grant permissions they hold themselves.
 func CreateAdmin(w http.ResponseWriter, r *http.Request) {
 	var adminRequest struct {
-		UserID      uint   `json:"user_id"`
-		Permissions string `json:"permissions"` // Define permission levels as needed
+		UserID      uint               `json:"user_id"`
+		Permissions models.Permissions `json:"permissions"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&adminRequest); err != nil {
@@ -21,6 +70,35 @@ func CreateAdmin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(adminRequest.Permissions) == 0 || !adminRequest.Permissions.Valid() {
+		http.Error(w, "Invalid permissions", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := AdminFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+	for _, permission := range adminRequest.Permissions {
+		if !caller.Permissions.Has(permission) {
+			http.Error(w, "Cannot grant a permission you do not have", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := db.First(&models.Player{}, adminRequest.UserID).Error; err != nil {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+
+	var count int64
+	db.Model(&models.Admin{}).Where("user_id = ?", adminRequest.UserID).Count(&count)
+	if count > 0 {
+		http.Error(w, "Player is already an admin", http.StatusConflict)
+		return
+	}
+
 	admin := models.Admin{
 		UserID:      adminRequest.UserID,
 		Permissions: adminRequest.Permissions,
@@ -36,13 +114,8 @@ func CreateAdmin(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(admin)
 }
 
-// Example of a protected admin route
+// DeletePlayer removes a player account. Requires the manage_players permission.
 func DeletePlayer(w http.ResponseWriter, r *http.Request) {
-	// Verify if the requester has admin permissions
-	// Extract user from JWT claims
-	// Check permissions
-
-	// Assuming permissions are verified
 	var deleteRequest struct {
 		PlayerID uint `json:"player_id"`
 	}
@@ -26,6 +26,11 @@ func CreateAlliance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	callerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
 	// Check if factions exist and belong to the same game instance
 	var factions []models.Faction
 	if err := db.Where("id IN ? AND game_instance_id = ?", allianceRequest.FactionIDs, allianceRequest.GameInstanceID).Find(&factions).Error; err != nil {
@@ -38,6 +43,18 @@ func CreateAlliance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only the leader of one of the factions may form the alliance
+	leadsFaction := false
+	for _, faction := range factions {
+		if faction.LeaderID == callerID {
+			leadsFaction = true
+		}
+	}
+	if !leadsFaction {
+		http.Error(w, "Only a faction leader can form an alliance", http.StatusForbidden)
+		return
+	}
+
 	// Create Alliance
 	alliance := models.Alliance{
 		GameInstanceID: allianceRequest.GameInstanceID,
@@ -62,6 +79,7 @@ func CreateAlliance(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	invalidateTeamBoards(alliance.GameInstanceID)
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(alliance)
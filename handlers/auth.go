@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"drokkit/models"
+	"drokkit/sessions"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = 1 * time.Hour       // How long an access token stays valid
+	refreshTokenTTL = 30 * 24 * time.Hour // How long a session can be kept alive by refreshing
+)
+
+var sessionStore sessions.Store = sessions.NewMemoryStore()
+
+// InitSessions replaces the store used for refresh tokens and session revocation
+func InitSessions(store sessions.Store) {
+	sessionStore = store
+}
+
+type contextKey string
+
+const playerContextKey contextKey = "player"
+
+// AuthenticatedPlayer is the identity established by the auth middleware for a request.
+type AuthenticatedPlayer struct {
+	ID        uint
+	Username  string
+	SessionID string
+}
+
+// tokenPair is returned to clients whenever a session is started or refreshed.
+type tokenPair struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// issueTokens creates a fresh access token and rotating refresh token for the session.
+func issueTokens(player models.Player, session sessions.Session) (tokenPair, error) {
+	accessToken, expirationTime, err := issueAccessToken(player, session.ID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refreshToken, err := sessions.NewRefreshToken()
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if err := sessionStore.SaveRefreshToken(refreshToken, session); err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{Token: accessToken, RefreshToken: refreshToken, ExpiresAt: expirationTime}, nil
+}
+
+// issueAccessToken signs a JWT identifying the player and their session.
+func issueAccessToken(player models.Player, sessionID string) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(accessTokenTTL)
+
+	claims := &Claims{
+		Username:  player.Username,
+		UserID:    player.ID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(player.ID), 10),
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(JwtKey)
+	return tokenString, expirationTime, err
+}
+
+// ParseToken validates a signed JWT and returns its claims.
+func ParseToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return JwtKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// TokenFromRequest extracts the JWT from an "Authorization: Bearer" header,
+// falling back to the token cookie.
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if scheme, token, found := strings.Cut(header, " "); found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if cookie, err := r.Cookie("token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// WithAuthenticatedPlayer returns a context carrying the player identified by the claims.
+// Tokens belonging to a revoked session are rejected.
+func WithAuthenticatedPlayer(ctx context.Context, claims *Claims) (context.Context, error) {
+	if claims.SessionID != "" {
+		revoked, err := sessionStore.IsRevoked(claims.SessionID)
+		if err != nil {
+			return ctx, err
+		}
+		if revoked {
+			return ctx, errors.New("session revoked")
+		}
+	}
+
+	player := AuthenticatedPlayer{ID: claims.UserID, Username: claims.Username, SessionID: claims.SessionID}
+
+	// Tokens issued without a user ID are resolved through the username
+	if player.ID == 0 {
+		var record models.Player
+		if err := db.Select("id").Where("username = ?", claims.Username).First(&record).Error; err != nil {
+			return ctx, errors.New("unknown player")
+		}
+		player.ID = record.ID
+	}
+
+	return context.WithValue(ctx, playerContextKey, player), nil
+}
+
+// PlayerFromContext returns the authenticated player stored in the context.
+func PlayerFromContext(ctx context.Context) (AuthenticatedPlayer, bool) {
+	player, ok := ctx.Value(playerContextKey).(AuthenticatedPlayer)
+	return player, ok && player.ID != 0
+}
+
+// actingPlayer returns the ID of the authenticated player making the request. A non-zero
+// claimed ID taken from the request body must match it; otherwise the request is trying to
+// act on behalf of someone else and is rejected. The error response has been written when ok is false.
+func actingPlayer(w http.ResponseWriter, r *http.Request, claimed uint) (uint, bool) {
+	player, ok := PlayerFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return 0, false
+	}
+	if claimed != 0 && claimed != player.ID {
+		http.Error(w, "Cannot act on behalf of another player", http.StatusForbidden)
+		return 0, false
+	}
+	return player.ID, true
+}
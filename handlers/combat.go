@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"drokkit/combat"
+	"drokkit/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// combatRequest orders an attacker's units against a defending faction or a zone.
+type combatRequest struct {
+	GameInstanceID uint `json:"game_instance_id"`
+	AttackerID     uint `json:"attacker_id"`
+	DefenderID     uint `json:"defender_id"`
+	ZoneID         uint `json:"zone_id"`
+	Units          int  `json:"units"`
+}
+
+// lockFaction loads a faction of a game instance, locking its row for the rest of the transaction.
+func lockFaction(tx *gorm.DB, instanceID, factionID uint) (models.Faction, error) {
+	var faction models.Faction
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("game_instance_id = ?", instanceID).
+		First(&faction, factionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return faction, &InstanceError{Status: http.StatusNotFound, Message: "Faction not found"}
+	}
+	return faction, err
+}
+
+// lockZone loads a zone of a game instance, locking its row for the rest of the transaction.
+func lockZone(tx *gorm.DB, instanceID, zoneID uint) (models.Zone, error) {
+	var zone models.Zone
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("game_instance_id = ?", instanceID).
+		First(&zone, zoneID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return zone, &InstanceError{Status: http.StatusNotFound, Message: "Zone not found"}
+	}
+	return zone, err
+}
+
+// allied reports whether two factions belong to the same alliance.
+func allied(tx *gorm.DB, a, b uint) (bool, error) {
+	var count int64
+	err := tx.Table("alliance_members AS a").
+		Joins("JOIN alliance_members AS b ON b.alliance_id = a.alliance_id AND b.deleted_at IS NULL").
+		Where("a.faction_id = ? AND b.faction_id = ? AND a.deleted_at IS NULL", a, b).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// resolveCombat fights a battle ordered by the attacking faction's leader, records it with
+// a CombatEvent per round and removes the units each side lost. An attacker that wins a
+// zone captures it.
+func resolveCombat(playerID uint, order combatRequest) (models.CombatLog, error) {
+	var combatLog models.CombatLog
+	var capture *ZoneCapture
+	if order.Units <= 0 {
+		return combatLog, &InstanceError{Status: http.StatusBadRequest, Message: "units must be positive"}
+	}
+	if (order.DefenderID == 0) == (order.ZoneID == 0) {
+		return combatLog, &InstanceError{Status: http.StatusBadRequest, Message: "Attack either a defending faction or a zone"}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The instance lock serializes combats, and with them the instance's random draws
+		instance, err := lockInstance(tx, order.GameInstanceID)
+		if err != nil {
+			return err
+		}
+		if !hasPlayer(instance, playerID) {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Not a player in this game instance"}
+		}
+		if instance.Status != models.InstanceActive {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+		}
+
+		attacker, err := lockFaction(tx, instance.ID, order.AttackerID)
+		if err != nil {
+			return err
+		}
+		if attacker.LeaderID != playerID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the faction leader can order an attack"}
+		}
+		if order.Units > attacker.Units {
+			return &InstanceError{Status: http.StatusConflict, Message: "Not enough units"}
+		}
+
+		// Work out who is defending, and with what
+		defender := combat.Side{Modifier: 1}
+		var defending models.Faction
+		var zone models.Zone
+		if order.ZoneID != 0 {
+			if zone, err = lockZone(tx, instance.ID, order.ZoneID); err != nil {
+				return err
+			}
+			if zone.ControlledByFactionID == attacker.ID {
+				return &InstanceError{Status: http.StatusConflict, Message: "Zone is already controlled by the attacker"}
+			}
+			borders, err := bordersFaction(tx, zone, attacker.ID)
+			if err != nil {
+				return err
+			}
+			if !borders {
+				return &InstanceError{Status: http.StatusConflict, Message: "Zone does not border the attacker's territory"}
+			}
+			defender.Units = zone.Garrison
+			if zone.ControlledByFactionID != 0 {
+				if defending, err = lockFaction(tx, instance.ID, zone.ControlledByFactionID); err != nil {
+					return err
+				}
+			}
+		} else {
+			if order.DefenderID == attacker.ID {
+				return &InstanceError{Status: http.StatusBadRequest, Message: "A faction cannot attack itself"}
+			}
+			if defending, err = lockFaction(tx, instance.ID, order.DefenderID); err != nil {
+				return err
+			}
+			defender.Units = defending.Units
+		}
+		if defending.ID != 0 {
+			isAllied, err := allied(tx, attacker.ID, defending.ID)
+			if err != nil {
+				return err
+			}
+			if isAllied {
+				return &InstanceError{Status: http.StatusConflict, Message: "Cannot attack an allied faction"}
+			}
+			defender.Modifier = defending.DefenseStrength
+		}
+
+		// The log is created first so its ID can label the battle's random draws
+		combatLog = models.CombatLog{
+			GameInstanceID: instance.ID,
+			AttackerID:     attacker.ID,
+			DefenderID:     defending.ID,
+			ZoneID:         zone.ID,
+			Outcome:        combat.Draw,
+			Timestamp:      time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := tx.Create(&combatLog).Error; err != nil {
+			return err
+		}
+
+		roller, err := newInstanceRNG(tx, instance)
+		if err != nil {
+			return err
+		}
+		attack := combat.Side{Units: order.Units, Modifier: attacker.CombatBonus}
+		result, err := combat.Resolve(roller, fmt.Sprintf("combat:%d", combatLog.ID), attack, defender)
+		if err != nil {
+			return err
+		}
+
+		for _, round := range result.Rounds {
+			detail, err := json.Marshal(round)
+			if err != nil {
+				return err
+			}
+			event := models.CombatEvent{CombatLogID: combatLog.ID, Round: round.Round, EventDetail: string(detail)}
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+			combatLog.CombatEvents = append(combatLog.CombatEvents, event)
+		}
+
+		combatLog.Outcome = result.Outcome
+		combatLog.UnitsLostAttacker = result.AttackerLosses
+		combatLog.UnitsLostDefender = result.DefenderLosses
+		if err := tx.Omit(clause.Associations).Save(&combatLog).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case zone.ID != 0 && result.Outcome == combat.AttackerWins:
+			// The surviving attackers stay behind to hold the zone
+			capture = &ZoneCapture{PreviousFactionID: zone.ControlledByFactionID, CombatLogID: combatLog.ID}
+			if err := captureZone(tx, &zone, attacker.ID, order.Units-result.AttackerLosses); err != nil {
+				return err
+			}
+			capture.Zone = zone
+			return tx.Model(&attacker).Update("units", attacker.Units-order.Units).Error
+		case zone.ID != 0:
+			if err := tx.Model(&zone).Update("garrison", zone.Garrison-result.DefenderLosses).Error; err != nil {
+				return err
+			}
+		default:
+			if err := tx.Model(&defending).Update("units", defending.Units-result.DefenderLosses).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&attacker).Update("units", attacker.Units-result.AttackerLosses).Error
+	})
+	if err != nil {
+		return combatLog, err
+	}
+
+	invalidateTeamBoards(combatLog.GameInstanceID)
+	broadcastCombat(combatLog)
+	if capture != nil {
+		broadcastZoneCapture(*capture)
+	}
+	checkVictory(combatLog.GameInstanceID)
+	return combatLog, nil
+}
+
+// broadcastCombat sends a resolved battle to everyone connected to its game instance's room.
+func broadcastCombat(combatLog models.CombatLog) {
+	payload, err := json.Marshal(combatLog)
+	if err != nil {
+		log.Printf("Failed to encode combat log %d: %v", combatLog.ID, err)
+		return
+	}
+	hub.Broadcast(InstanceRoomID(combatLog.GameInstanceID), WSMessage{Type: MessageCombatResolved, GameInstanceID: combatLog.GameInstanceID, Payload: payload}, 0)
+}
+
+// Attack lets a faction leader commit units against another faction or a zone.
+func Attack(w http.ResponseWriter, r *http.Request) {
+	var order combatRequest
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	combatLog, err := resolveCombat(playerID, order)
+	if err != nil {
+		writeInstanceError(w, err, "Failed to resolve combat")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(combatLog)
+}
+
+// handleCombat handles a combat message received over the WebSocket in a game instance room.
+func handleCombat(pc *PlayerConnection, instanceID uint, message WSMessage) {
+	var order combatRequest
+	if instanceID == 0 || json.Unmarshal(message.Payload, &order) != nil {
+		pc.Send(WSMessage{Type: MessageError, Error: "Invalid combat request"})
+		return
+	}
+	order.GameInstanceID = instanceID
+
+	if _, err := resolveCombat(pc.PlayerID, order); err != nil {
+		reason := "Failed to resolve combat"
+		var instanceErr *InstanceError
+		if errors.As(err, &instanceErr) {
+			reason = instanceErr.Message
+		}
+		pc.Send(WSMessage{Type: MessageError, GameInstanceID: instanceID, Error: reason})
+	}
+}
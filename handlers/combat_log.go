@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"drokkit/combat"
+	"drokkit/models"
+	"gorm.io/gorm"
+)
+
+// Combat log page sizes
+const (
+	defaultCombatLogLimit = 50
+	maxCombatLogLimit     = 100
+)
+
+// Combat replay pacing
+const (
+	combatReplayInterval = time.Second // Time between rounds at normal speed
+	minCombatReplaySpeed = 0.25
+	maxCombatReplaySpeed = 10
+)
+
+// CombatEventDetail is a combat event with its detail decoded.
+type CombatEventDetail struct {
+	ID     uint         `json:"id"`
+	Round  int          `json:"round"`
+	Detail combat.Round `json:"detail"`
+}
+
+// CombatLogDetail is a combat log with its events in order and decoded.
+type CombatLogDetail struct {
+	models.CombatLog
+	CombatEvents []CombatEventDetail `json:"combat_events"`
+}
+
+// CombatLogPage is a page of a game instance's combat logs, newest first.
+type CombatLogPage struct {
+	CombatLogs []models.CombatLog `json:"combat_logs"`
+	Next       uint               `json:"next,omitempty"` // Pass as before to get the next page
+}
+
+// canViewCombat reports whether a player may look at a game instance's battles: its own
+// players at any time, and anyone once the game has completed.
+func canViewCombat(instance models.GameInstance, playerID uint) bool {
+	return instance.Status == models.InstanceCompleted || isInstancePlayer(instance.ID, playerID)
+}
+
+// combatLogDetail loads a combat log the player may view, with its decoded events.
+func combatLogDetail(combatLogID, playerID uint) (CombatLogDetail, error) {
+	var detail CombatLogDetail
+	err := db.Preload("CombatEvents", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("round")
+	}).First(&detail.CombatLog, combatLogID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return detail, &InstanceError{Status: http.StatusNotFound, Message: "Combat log not found"}
+	}
+	if err != nil {
+		return detail, err
+	}
+
+	var instance models.GameInstance
+	if err := db.First(&instance, detail.GameInstanceID).Error; err != nil {
+		return detail, err
+	}
+	if !canViewCombat(instance, playerID) {
+		return detail, &InstanceError{Status: http.StatusForbidden, Message: "Not a player in this game instance"}
+	}
+
+	detail.CombatEvents = make([]CombatEventDetail, len(detail.CombatLog.CombatEvents))
+	for i, event := range detail.CombatLog.CombatEvents {
+		detail.CombatEvents[i] = CombatEventDetail{ID: event.ID, Round: event.Round}
+		if err := json.Unmarshal([]byte(event.EventDetail), &detail.CombatEvents[i].Detail); err != nil {
+			return detail, err
+		}
+	}
+	return detail, nil
+}
+
+// ListCombatLogs returns a game instance's combat logs, newest first, without their events.
+func ListCombatLogs(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var instance models.GameInstance
+	if err := db.First(&instance, instanceID).Error; err != nil {
+		http.Error(w, "Game instance not found", http.StatusNotFound)
+		return
+	}
+	if !canViewCombat(instance, playerID) {
+		http.Error(w, "Not a player in this game instance", http.StatusForbidden)
+		return
+	}
+
+	numbers := map[string]uint64{"limit": defaultCombatLogLimit}
+	for _, param := range []string{"attacker_id", "defender_id", "zone_id", "before", "limit"} {
+		raw := r.URL.Query().Get(param)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid "+param, http.StatusBadRequest)
+			return
+		}
+		numbers[param] = n
+	}
+
+	query := db.Where("game_instance_id = ?", instance.ID)
+	for _, filter := range []string{"attacker_id", "defender_id", "zone_id"} {
+		if id, ok := numbers[filter]; ok {
+			query = query.Where(filter+" = ?", id)
+		}
+	}
+	for param, condition := range map[string]string{"since": "created_at >= ?", "until": "created_at < ?"} {
+		raw := r.URL.Query().Get(param)
+		if raw == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Invalid "+param+", expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		query = query.Where(condition, at)
+	}
+	if before := numbers["before"]; before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	limit := int(numbers["limit"])
+	if limit == 0 || limit > maxCombatLogLimit {
+		limit = maxCombatLogLimit
+	}
+
+	page := CombatLogPage{CombatLogs: []models.CombatLog{}}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&page.CombatLogs).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(page.CombatLogs) > limit {
+		page.CombatLogs = page.CombatLogs[:limit]
+		page.Next = page.CombatLogs[limit-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetCombatLog returns a combat log with its events in order.
+func GetCombatLog(w http.ResponseWriter, r *http.Request) {
+	combatLogID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid combat log ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	detail, err := combatLogDetail(combatLogID, playerID)
+	if err != nil {
+		writeInstanceError(w, err, "Database error")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(detail)
+}
+
+// handleCombatReplay handles a combat_replay message received over the WebSocket. The
+// battle's rounds are sent to the connection one at a time, paced by the requested speed,
+// followed by the full combat log once the replay is over.
+func handleCombatReplay(pc *PlayerConnection, message WSMessage) {
+	var replayRequest struct {
+		CombatLogID uint    `json:"combat_log_id"`
+		Speed       float64 `json:"speed"`
+	}
+	if json.Unmarshal(message.Payload, &replayRequest) != nil || replayRequest.CombatLogID == 0 {
+		pc.Send(WSMessage{Type: MessageError, Error: "Invalid replay request"})
+		return
+	}
+	speed := replayRequest.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	if speed < minCombatReplaySpeed || speed > maxCombatReplaySpeed {
+		pc.Send(WSMessage{Type: MessageError, Error: "speed must be between 0.25 and 10"})
+		return
+	}
+
+	detail, err := combatLogDetail(replayRequest.CombatLogID, pc.PlayerID)
+	if err != nil {
+		reason := "Failed to load combat log"
+		var instanceErr *InstanceError
+		if errors.As(err, &instanceErr) {
+			reason = instanceErr.Message
+		}
+		pc.Send(WSMessage{Type: MessageError, Error: reason})
+		return
+	}
+
+	go replayCombat(pc, detail, time.Duration(float64(combatReplayInterval)/speed))
+}
+
+// replayCombat streams a battle's rounds to a connection, stopping early if it closes.
+func replayCombat(pc *PlayerConnection, detail CombatLogDetail, interval time.Duration) {
+	for i, event := range detail.CombatEvents {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to encode combat event %d: %v", event.ID, err)
+			return
+		}
+		if err := pc.Send(WSMessage{Type: MessageCombatReplayEvent, GameInstanceID: detail.GameInstanceID, Payload: payload}); err != nil {
+			return
+		}
+	}
+
+	payload, err := json.Marshal(detail)
+	if err != nil {
+		log.Printf("Failed to encode combat log %d: %v", detail.ID, err)
+		return
+	}
+	time.Sleep(interval)
+	pc.Send(WSMessage{Type: MessageCombatReplayDone, GameInstanceID: detail.GameInstanceID, Payload: payload})
+}
@@ -5,6 +5,9 @@ import (
 	"drokkit/models"
 	"encoding/json"
 	"net/http"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 // CreateFaction allows a player to create a new faction within a game instance.
@@ -20,63 +23,86 @@ func CreateFaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate FactionType
-	validTypes := map[string]bool{
-		"Industrialists": true,
-		"Warriors":       true,
-		"Technologists":  true,
-		"Traders":        true,
+	// The authenticated player becomes the leader
+	leaderID, ok := actingPlayer(w, r, factionRequest.LeaderID)
+	if !ok {
+		return
+	}
+
+	// Factions belong to a game instance the leader is playing in
+	if _, err := instanceForPlayer(factionRequest.GameInstanceID, leaderID); err != nil {
+		writeInstanceError(w, err, "Database error")
+		return
 	}
 
-	if !validTypes[factionRequest.FactionType] {
+	archetype, ok := factionTypes.Get(factionRequest.FactionType)
+	if !ok {
 		http.Error(w, "Invalid faction type", http.StatusBadRequest)
 		return
 	}
 
-	// Create Faction
+	// The faction keeps the bonuses it was created with, even if its type is tuned later
 	faction := models.Faction{
-		GameInstanceID: factionRequest.GameInstanceID,
-		FactionType:    factionRequest.FactionType,
-		LeaderID:       factionRequest.LeaderID,
+		GameInstanceID:  factionRequest.GameInstanceID,
+		FactionType:     archetype.Name,
+		LeaderID:        leaderID,
+		ResourceBonus:   archetype.ResourceBonus,
+		CombatBonus:     archetype.CombatBonus,
+		BuildingSpeed:   archetype.BuildingSpeed,
+		ResearchSpeed:   archetype.ResearchSpeed,
+		TradeRate:       archetype.TradeRate,
+		DefenseStrength: archetype.DefenseStrength,
+		Units:           archetype.StartingUnits,
 	}
 
-	// Set bonuses based on faction type
-	switch factionRequest.FactionType {
-	case "Industrialists":
-		faction.ResourceBonus = 1.2
-		faction.CombatBonus = 0.8
-		faction.BuildingSpeed = 1.5
-		faction.ResearchSpeed = 1.0
-		faction.TradeRate = 1.0
-		faction.DefenseStrength = 1.0
-	case "Warriors":
-		faction.ResourceBonus = 0.8
-		faction.CombatBonus = 1.5
-		faction.BuildingSpeed = 1.0
-		faction.ResearchSpeed = 1.0
-		faction.TradeRate = 1.0
-		faction.DefenseStrength = 1.2
-	case "Technologists":
-		faction.ResourceBonus = 1.0
-		faction.CombatBonus = 1.0
-		faction.BuildingSpeed = 1.0
-		faction.ResearchSpeed = 1.5
-		faction.TradeRate = 1.0
-		faction.DefenseStrength = 1.0
-	case "Traders":
-		faction.ResourceBonus = 1.0
-		faction.CombatBonus = 0.8
-		faction.BuildingSpeed = 1.0
-		faction.ResearchSpeed = 1.0
-		faction.TradeRate = 1.5
-		faction.DefenseStrength = 0.8
-	}
+	// The leader is the faction's first member. Locking the instance keeps two requests
+	// from making the same player a member of two factions in it.
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockInstance(tx, faction.GameInstanceID); err != nil {
+			return err
+		}
+		var memberships int64
+		if err := tx.Model(&models.FactionMember{}).
+			Where("game_instance_id = ? AND player_id = ?", faction.GameInstanceID, leaderID).
+			Count(&memberships).Error; err != nil {
+			return err
+		}
+		if memberships > 0 {
+			return &InstanceError{Status: http.StatusConflict, Message: "Player already belongs to a faction in this game instance"}
+		}
 
-	if err := db.Create(&faction).Error; err != nil {
-		http.Error(w, "Failed to create faction", http.StatusInternalServerError)
+		if err := tx.Create(&faction).Error; err != nil {
+			return err
+		}
+		member := models.FactionMember{GameInstanceID: faction.GameInstanceID, FactionID: faction.ID, PlayerID: leaderID, JoinedAt: time.Now()}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		faction.FactionMembers = append(faction.FactionMembers, member)
+		return nil
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to create faction")
 		return
 	}
+	invalidateTeamBoards(faction.GameInstanceID)
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(faction)
 }
+
+// playerFaction loads the faction a player belongs to in a game instance. It reports false
+// for players without a faction.
+func playerFaction(tx *gorm.DB, instanceID, playerID uint) (models.Faction, bool, error) {
+	var factions []models.Faction
+	if err := tx.Joins("JOIN faction_members AS fm ON fm.faction_id = factions.id AND fm.deleted_at IS NULL").
+		Where("fm.game_instance_id = ? AND fm.player_id = ?", instanceID, playerID).
+		Limit(1).
+		Find(&factions).Error; err != nil {
+		return models.Faction{}, false, err
+	}
+	if len(factions) == 0 {
+		return models.Faction{}, false, nil
+	}
+	return factions[0], true, nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"drokkit/archetypes"
+)
+
+// factionReloadInterval is how often the faction type file is checked for changes.
+const factionReloadInterval = 30 * time.Second
+
+// factionTypes holds the faction archetypes players can choose from.
+var factionTypes = archetypes.DefaultRegistry()
+
+// InitFactionTypes reads the faction archetypes from a YAML or JSON file. Without a file
+// the built-in archetypes are used.
+func InitFactionTypes(path string) error {
+	if path == "" {
+		return nil
+	}
+	registry, err := archetypes.NewRegistry(path)
+	if err != nil {
+		return err
+	}
+	factionTypes = registry
+	log.Printf("Loaded %d faction types from %s", len(registry.All()), path)
+	return nil
+}
+
+// StartFactionTypeReload reloads the faction type file whenever it changes, until stop is
+// closed. A file that fails to load is logged and the current faction types are kept.
+func StartFactionTypeReload(stop <-chan struct{}) {
+	if factionTypes.Path() == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(factionReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reloaded, err := factionTypes.ReloadIfChanged()
+				if err != nil {
+					log.Printf("Failed to reload faction types, keeping the current ones: %v", err)
+				} else if reloaded {
+					log.Printf("Reloaded %d faction types from %s", len(factionTypes.All()), factionTypes.Path())
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// ListFactionTypes returns every faction type with its bonuses.
+func ListFactionTypes(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(factionTypes.All())
+}
+
+// ReplaceFactionTypes lets an admin replace every faction type. The new types are written
+// to the faction type file when there is one. Existing factions keep their bonuses.
+func ReplaceFactionTypes(w http.ResponseWriter, r *http.Request) {
+	var list []archetypes.Archetype
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&list); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := factionTypes.Replace(list); err != nil {
+		if errors.Is(err, archetypes.ErrInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to save faction types: %v", err)
+		http.Error(w, "Failed to save faction types", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(factionTypes.All())
+}
+
+// ReloadFactionTypes lets an admin reload the faction type file straight away.
+func ReloadFactionTypes(w http.ResponseWriter, r *http.Request) {
+	if factionTypes.Path() == "" {
+		http.Error(w, "No faction type file is configured", http.StatusConflict)
+		return
+	}
+	if err := factionTypes.Reload(); err != nil {
+		if errors.Is(err, archetypes.ErrInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to reload faction types: %v", err)
+		http.Error(w, "Failed to read the faction type file", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(factionTypes.All())
+}
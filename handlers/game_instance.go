@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"drokkit/models"
+	"drokkit/rng"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Game instance player limits
+const (
+	minInstancePlayers        = 2
+	defaultInstanceMaxPlayers = 8
+	maxInstancePlayers        = 64
+)
+
+// InstanceError describes why a game instance operation was rejected and the HTTP status it maps to.
+type InstanceError struct {
+	Status  int
+	Message string
+}
+
+func (e *InstanceError) Error() string {
+	return e.Message
+}
+
+// writeInstanceError writes err to the response, using its status if it is an InstanceError.
+func writeInstanceError(w http.ResponseWriter, err error, fallback string) {
+	var instanceErr *InstanceError
+	if errors.As(err, &instanceErr) {
+		http.Error(w, instanceErr.Message, instanceErr.Status)
+		return
+	}
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
+
+// instanceTransitions lists the lifecycle states a game instance may move to from each state.
+var instanceTransitions = map[string][]string{
+	models.InstancePending: {models.InstanceActive},
+	models.InstanceActive:  {models.InstanceCompleted},
+}
+
+// transitionInstance moves the game instance to a new lifecycle state if the transition is
+// allowed, stamping when it started or ended.
+func transitionInstance(instance *models.GameInstance, status string) error {
+	from := instance.Status
+	if from == "" {
+		from = models.InstancePending
+	}
+
+	for _, next := range instanceTransitions[from] {
+		if next == status {
+			now := time.Now()
+			instance.Status = status
+			switch status {
+			case models.InstanceActive:
+				instance.StartedAt = &now
+			case models.InstanceCompleted:
+				instance.EndedAt = &now
+			}
+			return nil
+		}
+	}
+	return &InstanceError{Status: http.StatusConflict, Message: fmt.Sprintf("Game instance cannot move from %s to %s", from, status)}
+}
+
+// lockInstance loads a game instance and its players, locking the instance row for the
+// rest of the transaction.
+func lockInstance(tx *gorm.DB, instanceID uint) (models.GameInstance, error) {
+	var instance models.GameInstance
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Players").First(&instance, instanceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return instance, &InstanceError{Status: http.StatusNotFound, Message: "Game instance not found"}
+		}
+		return instance, err
+	}
+	return instance, nil
+}
+
+// hasPlayer reports whether the player has joined the game instance.
+func hasPlayer(instance models.GameInstance, playerID uint) bool {
+	for _, player := range instance.Players {
+		if player.PlayerID == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// isInstancePlayer reports whether the player has joined the game instance.
+func isInstancePlayer(instanceID, playerID uint) bool {
+	var count int64
+	db.Model(&models.GameInstancePlayer{}).
+		Where("game_instance_id = ? AND player_id = ?", instanceID, playerID).
+		Count(&count)
+	return count > 0
+}
+
+// instanceForPlayer loads a game instance the player has joined and that has not completed.
+func instanceForPlayer(instanceID, playerID uint) (models.GameInstance, error) {
+	var instance models.GameInstance
+	if err := db.First(&instance, instanceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return instance, &InstanceError{Status: http.StatusNotFound, Message: "Game instance not found"}
+		}
+		return instance, err
+	}
+	if !isInstancePlayer(instanceID, playerID) {
+		return instance, &InstanceError{Status: http.StatusForbidden, Message: "Not a player in this game instance"}
+	}
+	if instance.Status == models.InstanceCompleted {
+		return instance, &InstanceError{Status: http.StatusConflict, Message: "Game instance has completed"}
+	}
+	return instance, nil
+}
+
+// newInstance creates a pending game instance hosted by a player, with the given players joined.
+func newInstance(tx *gorm.DB, hostID uint, maxPlayers int, lobbyID uint, playerIDs []uint) (models.GameInstance, error) {
+	if maxPlayers == 0 {
+		maxPlayers = defaultInstanceMaxPlayers
+	}
+	if maxPlayers < minInstancePlayers || maxPlayers > maxInstancePlayers {
+		return models.GameInstance{}, &InstanceError{Status: http.StatusBadRequest, Message: fmt.Sprintf("max_players must be between %d and %d", minInstancePlayers, maxInstancePlayers)}
+	}
+	if len(playerIDs) > maxPlayers {
+		return models.GameInstance{}, &InstanceError{Status: http.StatusBadRequest, Message: "Too many players for this game instance"}
+	}
+
+	instance := models.GameInstance{
+		LobbyID:    lobbyID,
+		HostID:     hostID,
+		MaxPlayers: maxPlayers,
+		Status:     models.InstancePending,
+	}
+	now := time.Now()
+	for _, playerID := range playerIDs {
+		instance.Players = append(instance.Players, models.GameInstancePlayer{PlayerID: playerID, JoinedAt: now})
+	}
+
+	if err := tx.Create(&instance).Error; err != nil {
+		return instance, err
+	}
+	return instance, nil
+}
+
+// startInstance moves a pending game instance to active once enough players have joined,
+// generating the seed its random draws are made from and its map, handing out starting
+// resources and giving it the default victory condition if the host set none.
+func startInstance(tx *gorm.DB, instance *models.GameInstance) error {
+	if len(instance.Players) < minInstancePlayers {
+		return &InstanceError{Status: http.StatusConflict, Message: fmt.Sprintf("At least %d players are needed to start", minInstancePlayers)}
+	}
+	if err := transitionInstance(instance, models.InstanceActive); err != nil {
+		return err
+	}
+	seed, err := rng.NewSeed()
+	if err != nil {
+		return err
+	}
+	instance.RandomSeed = seed
+	if err := tx.Omit(clause.Associations).Save(instance).Error; err != nil {
+		return err
+	}
+	if err := ensureVictoryConditions(tx, instance); err != nil {
+		return err
+	}
+	if err := grantStartingResources(tx, *instance); err != nil {
+		return err
+	}
+	return generateMap(tx, instance)
+}
+
+// completeInstance moves an active game instance to completed.
+func completeInstance(tx *gorm.DB, instance *models.GameInstance) error {
+	if err := transitionInstance(instance, models.InstanceCompleted); err != nil {
+		return err
+	}
+	return tx.Omit(clause.Associations).Save(instance).Error
+}
+
+// broadcastInstanceUpdate sends the game instance to everyone connected to its room.
+func broadcastInstanceUpdate(instance models.GameInstance) {
+	payload, err := json.Marshal(instance)
+	if err != nil {
+		return
+	}
+	hub.Broadcast(InstanceRoomID(instance.ID), WSMessage{Type: MessageInstanceUpdated, GameInstanceID: instance.ID, Payload: payload}, 0)
+}
+
+// CreateInstance creates a pending game instance hosted by the authenticated player.
+func CreateInstance(w http.ResponseWriter, r *http.Request) {
+	hostID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var instanceRequest struct {
+		MaxPlayers int `json:"max_players"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&instanceRequest); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	instance, err := newInstance(db, hostID, instanceRequest.MaxPlayers, 0, []uint{hostID})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to create game instance")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(instance)
+}
+
+// ListInstances returns game instances, optionally filtered by status, newest first.
+func ListInstances(w http.ResponseWriter, r *http.Request) {
+	query := db.Preload("Players").Order("created_at DESC")
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != models.InstancePending && status != models.InstanceActive && status != models.InstanceCompleted {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	limit := queryInt(r, "limit", defaultLeaderboardLimit)
+	if limit == 0 || limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
+	}
+
+	instances := []models.GameInstance{}
+	if err := query.Limit(limit).Find(&instances).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(instances)
+}
+
+// GetInstance returns a game instance with its players, factions and alliances.
+func GetInstance(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+
+	var instance models.GameInstance
+	if err := db.Preload("Players").Preload("Factions").Preload("Alliances").First(&instance, instanceID).Error; err != nil {
+		http.Error(w, "Game instance not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(instance)
+}
+
+// JoinInstance adds the authenticated player to a pending game instance.
+func JoinInstance(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var instance models.GameInstance
+	err = db.Transaction(func(tx *gorm.DB) error {
+		instance, err = lockInstance(tx, instanceID)
+		if err != nil {
+			return err
+		}
+		if instance.Status != models.InstancePending {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance has already started"}
+		}
+		if hasPlayer(instance, playerID) {
+			return &InstanceError{Status: http.StatusConflict, Message: "Already joined this game instance"}
+		}
+		if len(instance.Players) >= instance.MaxPlayers {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is full"}
+		}
+
+		player := models.GameInstancePlayer{GameInstanceID: instance.ID, PlayerID: playerID, JoinedAt: time.Now()}
+		if err := tx.Create(&player).Error; err != nil {
+			return err
+		}
+		instance.Players = append(instance.Players, player)
+		return nil
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to join game instance")
+		return
+	}
+
+	broadcastInstanceUpdate(instance)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(instance)
+}
+
+// StartInstance lets the host start a pending game instance.
+func StartInstance(w http.ResponseWriter, r *http.Request) {
+	changeInstanceStatus(w, r, startInstance, "Failed to start game instance")
+}
+
+// CompleteInstance lets the host complete an active game instance.
+func CompleteInstance(w http.ResponseWriter, r *http.Request) {
+	changeInstanceStatus(w, r, completeInstance, "Failed to complete game instance")
+}
+
+// changeInstanceStatus applies a lifecycle change requested by the host of a game instance.
+func changeInstanceStatus(w http.ResponseWriter, r *http.Request, change func(*gorm.DB, *models.GameInstance) error, fallback string) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var instance models.GameInstance
+	err = db.Transaction(func(tx *gorm.DB) error {
+		instance, err = lockInstance(tx, instanceID)
+		if err != nil {
+			return err
+		}
+		if instance.HostID != playerID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the host can change the game instance status"}
+		}
+		return change(tx, &instance)
+	})
+	if err != nil {
+		writeInstanceError(w, err, fallback)
+		return
+	}
+
+	broadcastInstanceUpdate(instance)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(instance)
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
-	"github.com/golang-jwt/jwt/v4"
+	"drokkit/models"
+	"drokkit/rules"
 	"github.com/gorilla/websocket"
 )
 
@@ -18,85 +22,295 @@ var upgrader = websocket.Upgrader{
 
 // PlayerConnection represents an active WebSocket connection for a player
 type PlayerConnection struct {
-	Conn     *websocket.Conn
-	PlayerID uint
+	Conn      *websocket.Conn
+	PlayerID  uint
+	SessionID string // Session of the token the connection was opened with
+	writeMu   sync.Mutex
 }
 
+// Send writes a JSON message to the connection. Writes are serialized because
+// gorilla/websocket supports only one concurrent writer per connection.
+func (pc *PlayerConnection) Send(v interface{}) error {
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+	return pc.Conn.WriteJSON(v)
+}
+
+// closeSession closes every open connection that was opened with a token of the given
+// session, so a revoked session does not stay connected.
+func closeSession(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	connectionsMutex.Lock()
+	var conns []*PlayerConnection
+	for _, playerConns := range playerConnections {
+		for pc := range playerConns {
+			if pc.SessionID == sessionID {
+				conns = append(conns, pc)
+			}
+		}
+	}
+	connectionsMutex.Unlock()
+
+	// Closing the connection ends its read loop, which removes it from its room
+	closing := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Session revoked")
+	for _, pc := range conns {
+		pc.writeMu.Lock()
+		pc.Conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second))
+		pc.writeMu.Unlock()
+		pc.Conn.Close()
+	}
+}
+
+// WSMessage is the envelope for every message exchanged over /ws/play.
+type WSMessage struct {
+	Type           string          `json:"type"`
+	MatchID        uint            `json:"match_id,omitempty"`
+	GameInstanceID uint            `json:"game_instance_id,omitempty"`
+	PlayerID       uint            `json:"player_id,omitempty"`
+	Action         string          `json:"action,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// WebSocket message types
+const (
+	MessageMove         = "move"
+	MessageMoveRejected = "move_rejected"
+	MessageState        = "state"
+	MessageMatchOver    = "match_over"
+	MessagePlayerJoined = "player_joined"
+	MessagePlayerLeft   = "player_left"
+	MessageError        = "error"
+	MessageQueueJoin    = "queue_join"
+	MessageQueueJoined  = "queue_joined"
+	MessageQueueLeave   = "queue_leave"
+	MessageQueueLeft    = "queue_left"
+	MessageMatchFound   = "match_found"
+
+	MessageInstanceUpdated = "instance_updated"
+	MessageCombat          = "combat"
+	MessageCombatResolved  = "combat_resolved"
+	MessageZoneCaptured    = "zone_captured"
+	MessageGameOver        = "game_over"
+
+	MessageCombatReplay      = "combat_replay"
+	MessageCombatReplayEvent = "combat_replay_event"
+	MessageCombatReplayDone  = "combat_replay_done"
+
+	MessageTradeUpdated       = "trade_updated"
+	MessageMarketTrade        = "market_trade"
+	MessageMarketOrderUpdated = "market_order_updated"
+	MessageProjectCompleted   = "project_completed"
+
+	MessageLobbyUpdated = "lobby_updated"
+	MessageLobbyReady   = "lobby_ready"
+	MessageLobbyChat    = "lobby_chat"
+	MessageLobbyKicked  = "lobby_kicked"
+	MessageLobbyStarted = "lobby_started"
+)
+
 var (
-	playerConnections = make(map[uint]*PlayerConnection)
+	playerConnections = make(map[uint]map[*PlayerConnection]bool) // Every open connection of each player
 	connectionsMutex  sync.Mutex
 )
 
-// WebSocketHandler establishes a WebSocket connection and manages turns
-func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
-		http.Error(w, "Failed to upgrade WebSocket", http.StatusInternalServerError)
-		return
+// sendToPlayer delivers a message to every open connection of a player.
+func sendToPlayer(playerID uint, msg WSMessage) {
+	connectionsMutex.Lock()
+	conns := make([]*PlayerConnection, 0, len(playerConnections[playerID]))
+	for pc := range playerConnections[playerID] {
+		conns = append(conns, pc)
 	}
+	connectionsMutex.Unlock()
+
+	for _, pc := range conns {
+		if err := pc.Send(msg); err != nil {
+			log.Printf("Failed to send %s to player %d: %v", msg.Type, playerID, err)
+		}
+	}
+}
 
-	// Extract and validate JWT from query parameters
+// WebSocketHandler establishes a WebSocket connection, places the player in the room
+// for the requested match (or game instance) and handles the messages they send.
+func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract and validate JWT from the query parameters, Authorization header or cookie
 	tokenStr := r.URL.Query().Get("token")
+	if tokenStr == "" {
+		tokenStr = TokenFromRequest(r)
+	}
 	if tokenStr == "" {
 		http.Error(w, "Missing token", http.StatusUnauthorized)
 		return
 	}
 
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return JwtKey, nil
-	})
-	if err != nil || !token.Valid {
+	claims, err := ParseToken(tokenStr)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, err := WithAuthenticatedPlayer(r.Context(), claims)
+	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+	player, _ := PlayerFromContext(ctx)
+	playerID := player.ID
+
+	// Resolve the room the player is joining
+	room, status, msg := resolveRoom(r, playerID)
+	if status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
 
-	playerID := claims.UserID // Use a valid field that represents the player ID in `Claims`
-	log.Printf("Player %d connected", playerID)
+	// Upgrade HTTP connection to WebSocket
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	log.Printf("Player %d connected to %q", playerID, room.ID)
 
 	// Store the player connection
+	pc := &PlayerConnection{Conn: conn, PlayerID: playerID, SessionID: player.SessionID}
 	connectionsMutex.Lock()
-	playerConnections[playerID] = &PlayerConnection{Conn: conn, PlayerID: playerID}
+	if playerConnections[playerID] == nil {
+		playerConnections[playerID] = make(map[*PlayerConnection]bool)
+	}
+	playerConnections[playerID][pc] = true
 	connectionsMutex.Unlock()
 
+	if room.ID != "" {
+		hub.Join(room.ID, pc)
+		hub.Broadcast(room.ID, WSMessage{Type: MessagePlayerJoined, MatchID: room.MatchID, PlayerID: playerID}, playerID)
+	}
+
 	defer func() {
 		conn.Close()
 		connectionsMutex.Lock()
-		delete(playerConnections, playerID)
+		delete(playerConnections[playerID], pc)
+		if len(playerConnections[playerID]) == 0 {
+			delete(playerConnections, playerID)
+		}
 		connectionsMutex.Unlock()
-		log.Printf("Player %d disconnected", playerID)
+		if room.ID != "" {
+			hub.Leave(room.ID, pc)
+			hub.Broadcast(room.ID, WSMessage{Type: MessagePlayerLeft, MatchID: room.MatchID, PlayerID: playerID}, playerID)
+		}
+		log.Printf("Player %d disconnected from %q", playerID, room.ID)
 	}()
 
-	// Listen for moves from this player
+	// Listen for messages from this player
 	for {
-		var move PlayerMove
-		err := conn.ReadJSON(&move)
+		var message WSMessage
+		err := conn.ReadJSON(&message)
 		if err != nil {
 			log.Printf("Error reading JSON from player %d: %v", playerID, err)
 			break
 		}
-		handlePlayerMove(playerID, move)
+
+		switch message.Type {
+		case "", MessageMove:
+			// Messages without a type are treated as moves for older clients
+			handlePlayerMove(pc, room.MatchID, message)
+		case MessageQueueJoin:
+			handleQueueJoin(pc, message)
+		case MessageQueueLeave:
+			handleQueueLeave(pc)
+		case MessageLobbyReady:
+			handleLobbyReady(pc, room.LobbyID, message)
+		case MessageLobbyChat:
+			handleLobbyChat(pc, room.LobbyID, message)
+		case MessageCombat:
+			handleCombat(pc, room.GameInstanceID, message)
+		case MessageCombatReplay:
+			handleCombatReplay(pc, message)
+		default:
+			pc.Send(WSMessage{Type: MessageError, Error: "Unknown message type: " + message.Type})
+		}
 	}
 }
 
-func handlePlayerMove(playerID uint, move PlayerMove) {
-	moveJSON, err := json.Marshal(move)
-	if err != nil {
-		log.Printf("Failed to marshal move: %v", err)
+// wsRoom is the room a WebSocket connection joined and the match, game instance or lobby
+// it belongs to.
+type wsRoom struct {
+	ID             string
+	MatchID        uint
+	GameInstanceID uint
+	LobbyID        uint
+}
+
+// resolveRoom works out which room the request targets from the match_id,
+// game_instance_id or lobby_id query parameter and checks the player belongs to it.
+// Without any of them the connection joins no room and only receives messages sent
+// to the player directly, such as matchmaking results.
+func resolveRoom(r *http.Request, playerID uint) (room wsRoom, status int, msg string) {
+	query := r.URL.Query()
+
+	if raw := query.Get("match_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return room, http.StatusBadRequest, "Invalid match_id"
+		}
+
+		var match models.Match
+		if err := db.First(&match, id).Error; err != nil {
+			return room, http.StatusNotFound, "Match not found"
+		}
+		if match.PlayerOne != playerID && match.PlayerTwo != playerID {
+			return room, http.StatusForbidden, "Not a participant in this match"
+		}
+		return wsRoom{ID: MatchRoomID(match.ID), MatchID: match.ID}, http.StatusOK, ""
+	}
+
+	if raw := query.Get("game_instance_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return room, http.StatusBadRequest, "Invalid game_instance_id"
+		}
+
+		if !isInstancePlayer(uint(id), playerID) {
+			return room, http.StatusForbidden, "Not a member of this game instance"
+		}
+		return wsRoom{ID: InstanceRoomID(uint(id)), GameInstanceID: uint(id)}, http.StatusOK, ""
+	}
+
+	if raw := query.Get("lobby_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return room, http.StatusBadRequest, "Invalid lobby_id"
+		}
+
+		var count int64
+		db.Model(&models.LobbyMember{}).Where("lobby_id = ? AND player_id = ?", id, playerID).Count(&count)
+		if count == 0 {
+			return room, http.StatusForbidden, "Not a member of this lobby"
+		}
+		return wsRoom{ID: LobbyRoomID(uint(id)), LobbyID: uint(id)}, http.StatusOK, ""
+	}
+
+	return room, http.StatusOK, ""
+}
+
+// handlePlayerMove runs a move received over the WebSocket through the same authoritative
+// turn pipeline as the REST API. Accepted moves are broadcast by applyTurn; rejected moves
+// are reported back to the sender only.
+func handlePlayerMove(pc *PlayerConnection, matchID uint, message WSMessage) {
+	if matchID == 0 {
+		pc.Send(WSMessage{Type: MessageMoveRejected, Action: message.Action, Error: "Moves can only be submitted in a match room"})
 		return
 	}
 
-	// Broadcast move to other players in the match
-	connectionsMutex.Lock()
-	for _, pc := range playerConnections {
-		if pc.PlayerID != playerID {
-			err := pc.Conn.WriteMessage(websocket.TextMessage, moveJSON)
-			if err != nil {
-				log.Printf("Failed to send move to player %d: %v", pc.PlayerID, err)
-			}
+	// Never trust the sender's claimed identity
+	if _, err := applyTurn(matchID, pc.PlayerID, rules.Move{Action: message.Action, Payload: message.Payload}); err != nil {
+		reason := "Failed to play turn"
+		var matchErr *MatchError
+		if errors.As(err, &matchErr) {
+			reason = matchErr.Message
 		}
+		pc.Send(WSMessage{Type: MessageMoveRejected, MatchID: matchID, Action: message.Action, Error: reason})
 	}
-	connectionsMutex.Unlock()
 }
@@ -4,10 +4,13 @@ package handlers
 
 import (
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
 	"github.com/nats-io/nats.go"
 	"gorm.io/gorm"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
 )
 
 var (
@@ -18,8 +21,9 @@ var (
 
 // Claims structure with UserID included for authentication
 type Claims struct {
-	Username string `json:"username"`
-	UserID   uint   `json:"id"`
+	Username  string `json:"username"`
+	UserID    uint   `json:"id"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -43,3 +47,9 @@ func PublishAlert(subject, message string) {
 		}
 	}
 }
+
+// pathID parses a numeric ID from the named route variable
+func pathID(r *http.Request, name string) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, 64)
+	return uint(id), err
+}
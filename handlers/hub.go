@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Room groups the WebSocket connections of players taking part in the same match or game instance.
+type Room struct {
+	ID      string
+	members map[uint]*PlayerConnection
+	mu      sync.Mutex
+}
+
+// Hub keeps track of every active room on this server.
+type Hub struct {
+	rooms map[string]*Room
+	mu    sync.Mutex
+}
+
+var hub = NewHub()
+
+// NewHub creates an empty hub.
+func NewHub() *Hub {
+	return &Hub{rooms: make(map[string]*Room)}
+}
+
+// MatchRoomID returns the room identifier used for a match.
+func MatchRoomID(matchID uint) string {
+	return fmt.Sprintf("match:%d", matchID)
+}
+
+// InstanceRoomID returns the room identifier used for a game instance.
+func InstanceRoomID(gameInstanceID uint) string {
+	return fmt.Sprintf("instance:%d", gameInstanceID)
+}
+
+// Join adds a connection to the room, creating the room if needed.
+func (h *Hub) Join(roomID string, pc *PlayerConnection) *Room {
+	h.mu.Lock()
+	room, ok := h.rooms[roomID]
+	if !ok {
+		room = &Room{ID: roomID, members: make(map[uint]*PlayerConnection)}
+		h.rooms[roomID] = room
+	}
+	h.mu.Unlock()
+
+	room.mu.Lock()
+	room.members[pc.PlayerID] = pc
+	room.mu.Unlock()
+	return room
+}
+
+// Leave removes a connection from the room and drops the room once it is empty.
+// The connection is only removed if it is still the one registered for the player,
+// so a reconnect does not get evicted by the old socket closing.
+func (h *Hub) Leave(roomID string, pc *PlayerConnection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[roomID]
+	if !ok {
+		return
+	}
+
+	room.mu.Lock()
+	if current, ok := room.members[pc.PlayerID]; ok && current == pc {
+		delete(room.members, pc.PlayerID)
+	}
+	empty := len(room.members) == 0
+	room.mu.Unlock()
+
+	if empty {
+		delete(h.rooms, roomID)
+	}
+}
+
+// Evict removes a player from the room whichever connection they joined with, e.g. when
+// they are kicked from a lobby.
+func (h *Hub) Evict(roomID string, playerID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[roomID]
+	if !ok {
+		return
+	}
+
+	room.mu.Lock()
+	delete(room.members, playerID)
+	empty := len(room.members) == 0
+	room.mu.Unlock()
+
+	if empty {
+		delete(h.rooms, roomID)
+	}
+}
+
+// Broadcast sends a message to every member of the room except the excluded player (0 excludes nobody).
+func (h *Hub) Broadcast(roomID string, msg WSMessage, exclude uint) {
+	h.mu.Lock()
+	room, ok := h.rooms[roomID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, pc := range room.Members() {
+		if pc.PlayerID == exclude {
+			continue
+		}
+		if err := pc.Send(msg); err != nil {
+			log.Printf("Failed to send %s to player %d in %s: %v", msg.Type, pc.PlayerID, roomID, err)
+		}
+	}
+}
+
+// Members returns a snapshot of the connections currently in the given room.
+func (h *Hub) Members(roomID string) []*PlayerConnection {
+	h.mu.Lock()
+	room, ok := h.rooms[roomID]
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return room.Members()
+}
+
+// Members returns a snapshot of the connections currently in the room.
+func (r *Room) Members() []*PlayerConnection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := make([]*PlayerConnection, 0, len(r.members))
+	for _, pc := range r.members {
+		members = append(members, pc)
+	}
+	return members
+}
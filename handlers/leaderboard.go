@@ -1,81 +1,497 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"drokkit/leaderboard"
 	"drokkit/models"
+	"drokkit/rules"
 	"github.com/go-redis/redis"
 	"gorm.io/gorm"
 )
 
 var (
-	redisClient *redis.Client
+	redisClient  *redis.Client
+	leaderboards *leaderboard.Board // Nil when Redis is not configured; boards are then read from SQL
 )
 
+// seasonTimeframe ranks players within a season rather than a calendar period.
+const seasonTimeframe = "season"
+
+// Leaderboard page sizes
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+	defaultAroundRadius     = 5
+)
+
+// LeaderboardEntry is a single player's position on a leaderboard.
+type LeaderboardEntry struct {
+	Rank         int64  `json:"rank"`
+	PlayerID     uint   `json:"player_id"`
+	Username     string `json:"username"`
+	GameType     string `json:"game_type"`
+	Rating       int    `json:"rating"`
+	RatingChange int    `json:"rating_change"` // Rating gained within the timeframe; zero for all-time boards
+	GamesPlayed  int    `json:"games_played"`
+}
+
 // InitLeaderboard initializes Redis and database
 func InitLeaderboard(database *gorm.DB, rdb *redis.Client) {
 	db = database
 	redisClient = rdb
+	if rdb != nil {
+		leaderboards = leaderboard.New(rdb)
+	}
 }
 
-// GetLeaderboard handles various types of leaderboard views
-func GetLeaderboard(w http.ResponseWriter, r *http.Request) {
-	leaderboardType := r.URL.Query().Get("type")
-	timeFrame := r.URL.Query().Get("timeframe")
+// LeaderboardPage is one page of a leaderboard. NextCursor is empty on the last page.
+type LeaderboardPage struct {
+	Entries    []LeaderboardEntry `json:"entries"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// leaderboardQuery holds the board selection shared by the leaderboard endpoints.
+// Every filter narrows the board further, so they can be combined freely.
+type leaderboardQuery struct {
+	GameType   string
+	Timeframe  string
+	Season     *models.Season // Set for the season timeframe
+	FactionID  uint           // Only players who are members of this faction
+	AllianceID uint           // Only players whose faction belongs to this alliance
+}
+
+// sqlOnly reports whether the board must be read from SQL. Redis only holds the full
+// calendar boards, so filtered and season boards are always computed.
+func (q leaderboardQuery) sqlOnly() bool {
+	return q.FactionID != 0 || q.AllianceID != 0 || q.Timeframe == seasonTimeframe
+}
+
+// leaderboardCursor marks the last entry of a page. The score and player ID let SQL
+// resume with a keyset query; the rank is enough for Redis.
+type leaderboardCursor struct {
+	Rank     int64 `json:"rank"`
+	Score    int   `json:"score"`
+	PlayerID uint  `json:"player_id"`
+}
+
+func encodeCursor(c leaderboardCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*leaderboardCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c leaderboardCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// score is the value an entry is ranked by on the query's board.
+func (q leaderboardQuery) score(entry LeaderboardEntry) int {
+	if q.Timeframe == leaderboard.AllTime || q.Timeframe == seasonTimeframe {
+		return entry.Rating
+	}
+	return entry.RatingChange
+}
+
+// parseLeaderboardQuery reads the type, timeframe, season_id, game_type, faction_id and
+// alliance_id query parameters. The error response has been written when ok is false.
+func parseLeaderboardQuery(w http.ResponseWriter, r *http.Request) (leaderboardQuery, bool) {
+	query := leaderboardQuery{
+		GameType:  r.URL.Query().Get("game_type"),
+		Timeframe: r.URL.Query().Get("timeframe"),
+	}
 
 	// Default to "all-time" if no timeframe is provided
-	if timeFrame == "" {
-		timeFrame = "all-time"
+	if query.Timeframe == "" {
+		query.Timeframe = leaderboard.AllTime
+	}
+	if query.GameType == "" {
+		query.GameType = rules.DefaultGameType
+	}
+
+	if leaderboardType := r.URL.Query().Get("type"); leaderboardType != "" && leaderboardType != "individual" {
+		http.Error(w, "Unsupported leaderboard type", http.StatusBadRequest)
+		return query, false
+	}
+	if query.Timeframe == seasonTimeframe {
+		season, status, message := resolveSeason(r.URL.Query().Get("season_id"))
+		if season == nil {
+			http.Error(w, message, status)
+			return query, false
+		}
+		query.Season = season
+	} else if !leaderboard.ValidTimeframe(query.Timeframe) {
+		http.Error(w, "Invalid timeframe", http.StatusBadRequest)
+		return query, false
+	}
+
+	for name, dest := range map[string]*uint{"faction_id": &query.FactionID, "alliance_id": &query.AllianceID} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || id == 0 {
+			http.Error(w, "Invalid "+name, http.StatusBadRequest)
+			return query, false
+		}
+		*dest = uint(id)
 	}
+	return query, true
+}
 
-	key := "leaderboard:" + leaderboardType + ":" + timeFrame
-	cache, err := redisClient.Get(key).Result()
+// queryInt reads a non-negative integer query parameter, falling back to def.
+func queryInt(r *http.Request, name string, def int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
 
-	// Check for cached leaderboard data
-	if err == nil {
-		w.Write([]byte(cache))
+// GetLeaderboard returns a page of a leaderboard
+func GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	switch kind := r.URL.Query().Get("type"); kind {
+	case leaderboard.Faction, leaderboard.Alliance:
+		GetTeamLeaderboard(w, r, kind)
 		return
 	}
 
-	// If not in cache, query and cache the result
-	leaderboard := fetchLeaderboardFromDB(leaderboardType, timeFrame)
-	leaderboardJSON, err := json.Marshal(leaderboard)
+	query, ok := parseLeaderboardQuery(w, r)
+	if !ok {
+		return
+	}
+
+	cursor, err := decodeCursor(r.URL.Query().Get("cursor"))
 	if err != nil {
-		http.Error(w, "Failed to encode leaderboard", http.StatusInternalServerError)
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
 		return
 	}
+	limit := queryInt(r, "limit", defaultLeaderboardLimit)
+	if limit == 0 || limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
+	}
 
-	redisClient.Set(key, leaderboardJSON, 15*time.Minute)
-	w.Write(leaderboardJSON)
+	entries, err := leaderboardPage(query, cursor, limit)
+	if err != nil {
+		http.Error(w, "Failed to load leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	page := LeaderboardPage{Entries: entries}
+	if page.Entries == nil {
+		page.Entries = []LeaderboardEntry{}
+	}
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		page.NextCursor = encodeCursor(leaderboardCursor{Rank: last.Rank, Score: query.score(last), PlayerID: last.PlayerID})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
 }
 
-// fetchLeaderboardFromDB queries the database based on the leaderboard type and timeframe
-func fetchLeaderboardFromDB(leaderboardType, timeFrame string) []models.Stats {
-	var stats []models.Stats
+// GetPlayerRank returns a player's position on a leaderboard and the players ranked around them
+func GetPlayerRank(w http.ResponseWriter, r *http.Request) {
+	playerID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid player ID", http.StatusBadRequest)
+		return
+	}
+
+	query, ok := parseLeaderboardQuery(w, r)
+	if !ok {
+		return
+	}
+	radius := queryInt(r, "radius", defaultAroundRadius)
+	if radius > maxLeaderboardLimit/2 {
+		radius = maxLeaderboardLimit / 2
+	}
 
-	// Modify query based on leaderboard type
-	switch leaderboardType {
-	case "individual":
-		db.Where("team_id IS NULL").Order("experience DESC").Find(&stats)
-	case "team":
-		// Assuming a model or stats aggregation for team leaderboard
-		db.Where("team_id IS NOT NULL").Order("experience DESC").Find(&stats)
-	default:
-		// Default to individual leaderboard if type is unrecognized
-		db.Order("experience DESC").Find(&stats)
+	entry, around, found, err := leaderboardAround(query, playerID, radius)
+	if err != nil {
+		http.Error(w, "Failed to load leaderboard", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Player is not on this leaderboard", http.StatusNotFound)
+		return
 	}
 
-	// Further filter by timeframe
-	switch timeFrame {
-	case "monthly":
-		db.Where("created_at >= ?", time.Now().AddDate(0, -1, 0)).Order("experience DESC").Find(&stats)
-	case "weekly":
-		db.Where("created_at >= ?", time.Now().AddDate(0, 0, -7)).Order("experience DESC").Find(&stats)
-	default:
-		db.Order("experience DESC").Find(&stats)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"player": entry,
+		"around": around,
+	})
+}
+
+// RebuildLeaderboards rebuilds every Redis board of a game type from the database.
+func RebuildLeaderboards(w http.ResponseWriter, r *http.Request) {
+	var rebuildRequest struct {
+		GameType string `json:"game_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&rebuildRequest); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if rebuildRequest.GameType == "" {
+		rebuildRequest.GameType = rules.DefaultGameType
 	}
 
-	return stats
+	if leaderboards == nil {
+		http.Error(w, "Redis leaderboards are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	for _, timeframe := range leaderboard.Timeframes {
+		if err := rebuildBoard(leaderboardQuery{GameType: rebuildRequest.GameType, Timeframe: timeframe}); err != nil {
+			http.Error(w, "Failed to rebuild leaderboard", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Leaderboards rebuilt"})
+}
+
+// leaderboardPage loads the page after the cursor from Redis, building the board from SQL
+// first if it does not exist yet. Without Redis, or for filtered boards, the page is read
+// straight from SQL.
+func leaderboardPage(query leaderboardQuery, cursor *leaderboardCursor, limit int) ([]LeaderboardEntry, error) {
+	if leaderboards == nil || query.sqlOnly() {
+		return fetchLeaderboardFromDB(query, cursor, limit)
+	}
+
+	if err := ensureBoard(query); err != nil {
+		return nil, err
+	}
+	var offset int64
+	if cursor != nil {
+		offset = cursor.Rank
+	}
+	ranked, err := leaderboards.Page(query.GameType, query.Timeframe, time.Now(), offset, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	return hydrateEntries(query, ranked)
+}
+
+// leaderboardAround finds a player on a board along with the players within radius places of them.
+func leaderboardAround(query leaderboardQuery, playerID uint, radius int) (LeaderboardEntry, []LeaderboardEntry, bool, error) {
+	if leaderboards == nil || query.sqlOnly() {
+		// The SQL fallback ranks the whole board, which is fine for the sizes it is used at
+		all, err := fetchLeaderboardFromDB(query, nil, 0)
+		if err != nil {
+			return LeaderboardEntry{}, nil, false, err
+		}
+		for i, entry := range all {
+			if entry.PlayerID == playerID {
+				start, end := i-radius, i+radius+1
+				if start < 0 {
+					start = 0
+				}
+				if end > len(all) {
+					end = len(all)
+				}
+				return entry, all[start:end], true, nil
+			}
+		}
+		return LeaderboardEntry{}, nil, false, nil
+	}
+
+	if err := ensureBoard(query); err != nil {
+		return LeaderboardEntry{}, nil, false, err
+	}
+	ranked, err := leaderboards.Around(query.GameType, query.Timeframe, time.Now(), playerID, int64(radius))
+	if err != nil || len(ranked) == 0 {
+		return LeaderboardEntry{}, nil, false, err
+	}
+	around, err := hydrateEntries(query, ranked)
+	if err != nil {
+		return LeaderboardEntry{}, nil, false, err
+	}
+	for _, entry := range around {
+		if entry.PlayerID == playerID {
+			return entry, around, true, nil
+		}
+	}
+	return LeaderboardEntry{}, nil, false, nil
+}
+
+// ensureBoard builds a Redis board from SQL if it does not exist, e.g. after a Redis restart.
+func ensureBoard(query leaderboardQuery) error {
+	exists, err := leaderboards.Exists(query.GameType, query.Timeframe, time.Now())
+	if err != nil || exists {
+		return err
+	}
+	return rebuildBoard(query)
+}
+
+// rebuildBoard replaces a Redis board with the standings computed from SQL.
+func rebuildBoard(query leaderboardQuery) error {
+	entries, err := fetchLeaderboardFromDB(query, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	ranked := make([]leaderboard.Entry, len(entries))
+	for i, entry := range entries {
+		ranked[i] = leaderboard.Entry{PlayerID: entry.PlayerID, Score: entry.Rating}
+		if query.Timeframe != leaderboard.AllTime {
+			ranked[i].Score = entry.RatingChange
+		}
+	}
+	return leaderboards.Rebuild(query.GameType, query.Timeframe, time.Now(), ranked)
+}
+
+// hydrateEntries fills in rating details for players ranked by Redis.
+func hydrateEntries(query leaderboardQuery, ranked []leaderboard.Entry) ([]LeaderboardEntry, error) {
+	ids := make([]uint, len(ranked))
+	for i, entry := range ranked {
+		ids[i] = entry.PlayerID
+	}
+
+	var ratings []models.Rating
+	if err := db.Where("game_type = ? AND player_id IN ?", query.GameType, ids).Find(&ratings).Error; err != nil {
+		return nil, err
+	}
+	byPlayer := make(map[uint]models.Rating, len(ratings))
+	for _, rating := range ratings {
+		byPlayer[rating.PlayerID] = rating
+	}
+
+	var players []models.Player
+	if err := db.Select("id, username").Where("id IN ?", ids).Find(&players).Error; err != nil {
+		return nil, err
+	}
+	usernames := make(map[uint]string, len(players))
+	for _, player := range players {
+		usernames[player.ID] = player.Username
+	}
+
+	entries := make([]LeaderboardEntry, len(ranked))
+	for i, entry := range ranked {
+		rating := byPlayer[entry.PlayerID]
+		entries[i] = LeaderboardEntry{
+			Rank:        entry.Rank,
+			PlayerID:    entry.PlayerID,
+			Username:    usernames[entry.PlayerID],
+			GameType:    query.GameType,
+			Rating:      rating.Rating,
+			GamesPlayed: rating.GamesPlayed,
+		}
+		if query.Timeframe != leaderboard.AllTime {
+			entries[i].RatingChange = entry.Score
+		}
+	}
+	return entries, nil
+}
+
+// recordLeaderboardResult pushes the rating changes of a finished match to the Redis boards.
+func recordLeaderboardResult(match models.Match) {
+	if leaderboards == nil {
+		return
+	}
+
+	var history []models.RatingHistory
+	if err := db.Where("match_id = ?", match.ID).Find(&history).Error; err != nil {
+		log.Printf("Failed to load rating history for match %d: %v", match.ID, err)
+		return
+	}
+	for _, change := range history {
+		if err := leaderboards.RecordResult(change.GameType, change.PlayerID, change.RatingAfter, change.Delta, change.CreatedAt); err != nil {
+			log.Printf("Failed to update leaderboards for player %d: %v", change.PlayerID, err)
+			// Drop the boards that missed the change so the next read rebuilds them
+			if err := leaderboards.Drop(change.GameType, change.CreatedAt); err != nil {
+				log.Printf("Failed to drop %s leaderboards: %v", change.GameType, err)
+			}
+		}
+	}
+}
+
+// leaderboardBoard builds the query computing every player's score on a board. The all-time
+// board is scored by current rating and weekly and monthly boards by the rating gained
+// since the start of the current calendar period. A season board is scored by rating among
+// the players who played during the season, taken from the archive once the season ends.
+func leaderboardBoard(database *gorm.DB, query leaderboardQuery) *gorm.DB {
+	switch {
+	case query.Timeframe == leaderboard.AllTime:
+		return database.Table("ratings").
+			Select("player_id, game_type, rating, 0 AS rating_change, games_played, rating AS score").
+			Where("game_type = ? AND deleted_at IS NULL", query.GameType)
+	case query.Season != nil && query.Season.Status == models.SeasonArchived:
+		return database.Table("season_standings").
+			Select("player_id, game_type, rating, rating_change, games_played, rating AS score").
+			Where("season_id = ? AND game_type = ? AND deleted_at IS NULL", query.Season.ID, query.GameType)
+	}
+
+	since, until := leaderboard.PeriodStart(query.Timeframe, time.Now()), time.Now()
+	score := "SUM(h.delta)"
+	if query.Season != nil {
+		since, until = query.Season.StartsAt, query.Season.EndsAt
+		score = "r.rating"
+	}
+	return database.Table("rating_histories AS h").
+		Select("h.player_id, h.game_type, r.rating, SUM(h.delta) AS rating_change, r.games_played, "+score+" AS score").
+		Joins("JOIN ratings AS r ON r.player_id = h.player_id AND r.game_type = h.game_type").
+		Where("h.game_type = ? AND h.created_at >= ? AND h.created_at < ? AND h.deleted_at IS NULL", query.GameType, since, until).
+		Group("h.player_id, h.game_type, r.rating, r.games_played")
+}
+
+// fetchLeaderboardFromDB ranks players on a board. Pages continue after the cursor; a limit
+// of zero returns the rest of the board.
+func fetchLeaderboardFromDB(query leaderboardQuery, cursor *leaderboardCursor, limit int) ([]LeaderboardEntry, error) {
+	board := leaderboardBoard(db, query)
+
+	// Rank over the computed board so every filter and the cursor apply to the same columns
+	tx := db.Table("(?) AS board", board).
+		Select("board.player_id, p.username, board.game_type, board.rating, board.rating_change, board.games_played").
+		Joins("JOIN players AS p ON p.id = board.player_id AND p.deleted_at IS NULL")
+	if query.FactionID != 0 {
+		tx = tx.Where("board.player_id IN (?)", db.Table("faction_members").
+			Select("player_id").
+			Where("faction_id = ? AND deleted_at IS NULL", query.FactionID))
+	}
+	if query.AllianceID != 0 {
+		tx = tx.Where("board.player_id IN (?)", db.Table("faction_members AS fm").
+			Select("fm.player_id").
+			Joins("JOIN alliance_members AS am ON am.faction_id = fm.faction_id AND am.deleted_at IS NULL").
+			Where("am.alliance_id = ? AND fm.deleted_at IS NULL", query.AllianceID))
+	}
+
+	var rank int64
+	if cursor != nil {
+		rank = cursor.Rank
+		tx = tx.Where("board.score < ? OR (board.score = ? AND board.player_id > ?)", cursor.Score, cursor.Score, cursor.PlayerID)
+	}
+	tx = tx.Order("board.score DESC, board.player_id")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	var entries []LeaderboardEntry
+	if err := tx.Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		entries[i].Rank = rank + int64(i) + 1
+	}
+	return entries, nil
 }
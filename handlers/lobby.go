@@ -0,0 +1,677 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"drokkit/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lobby limits
+const (
+	lobbyCodeLength      = 6
+	lobbyCodeAlphabet    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // No 0/O or 1/I, which are easily confused when shared
+	maxLobbyChatLength   = 500
+	lobbyChatHistorySize = 50
+)
+
+// lobbySettings is the part of a lobby the host can change.
+type lobbySettings struct {
+	Name       string          `json:"name"`
+	IsPrivate  bool            `json:"is_private"`
+	MaxPlayers int             `json:"max_players"`
+	Settings   json.RawMessage `json:"settings"`
+}
+
+// LobbyRoomID returns the room identifier used for a lobby.
+func LobbyRoomID(lobbyID uint) string {
+	return fmt.Sprintf("lobby:%d", lobbyID)
+}
+
+// newLobbyCode generates a random join code.
+func newLobbyCode() (string, error) {
+	buf := make([]byte, lobbyCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = lobbyCodeAlphabet[int(b)%len(lobbyCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// validateLobbySettings checks the settings chosen by the host. Lobbies may not be
+// made smaller than the number of players already in them.
+func validateLobbySettings(settings *lobbySettings, members int) error {
+	if settings.MaxPlayers == 0 {
+		settings.MaxPlayers = defaultInstanceMaxPlayers
+	}
+	if settings.MaxPlayers < minInstancePlayers || settings.MaxPlayers > maxInstancePlayers {
+		return &InstanceError{Status: http.StatusBadRequest, Message: fmt.Sprintf("max_players must be between %d and %d", minInstancePlayers, maxInstancePlayers)}
+	}
+	if settings.MaxPlayers < members {
+		return &InstanceError{Status: http.StatusConflict, Message: "Lobby already has more players than that"}
+	}
+	if len(settings.Settings) > 0 && !json.Valid(settings.Settings) {
+		return &InstanceError{Status: http.StatusBadRequest, Message: "Settings must be valid JSON"}
+	}
+	return nil
+}
+
+// lobbyMember returns the index of the player in the lobby's members, or -1.
+func lobbyMember(lobby models.Lobby, playerID uint) int {
+	for i, member := range lobby.Members {
+		if member.PlayerID == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// lockLobby loads a lobby and its members, locking the lobby row for the rest of the transaction.
+func lockLobby(tx *gorm.DB, lobbyID uint) (models.Lobby, error) {
+	var lobby models.Lobby
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("joined_at") }).
+		First(&lobby, lobbyID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return lobby, &InstanceError{Status: http.StatusNotFound, Message: "Lobby not found"}
+	}
+	return lobby, err
+}
+
+// updateLobby runs change against an open lobby the player is a member of, inside a
+// transaction holding the lobby lock, and pushes the updated lobby to its members.
+func updateLobby(lobbyID, playerID uint, change func(tx *gorm.DB, lobby *models.Lobby) error) (models.Lobby, error) {
+	var lobby models.Lobby
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		lobby, err = lockLobby(tx, lobbyID)
+		if err != nil {
+			return err
+		}
+		if lobby.Status != models.LobbyOpen {
+			return &InstanceError{Status: http.StatusConflict, Message: "Lobby is no longer open"}
+		}
+		if lobbyMember(lobby, playerID) == -1 {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Not a member of this lobby"}
+		}
+		return change(tx, &lobby)
+	})
+	if err != nil {
+		return lobby, err
+	}
+
+	broadcastLobbyUpdate(lobby)
+	return lobby, nil
+}
+
+// requireHost rejects lobby changes made by anyone but the host.
+func requireHost(lobby *models.Lobby, playerID uint) error {
+	if lobby.HostID != playerID {
+		return &InstanceError{Status: http.StatusForbidden, Message: "Only the host can do that"}
+	}
+	return nil
+}
+
+// removeLobbyMember takes a player out of a lobby. If the host leaves, the longest-standing
+// member becomes host; if nobody is left, the lobby closes.
+func removeLobbyMember(tx *gorm.DB, lobby *models.Lobby, playerID uint) error {
+	i := lobbyMember(*lobby, playerID)
+	if i == -1 {
+		return &InstanceError{Status: http.StatusNotFound, Message: "Player is not in this lobby"}
+	}
+	// Hard delete so the player can rejoin later without hitting the unique index
+	if err := tx.Unscoped().Delete(&lobby.Members[i]).Error; err != nil {
+		return err
+	}
+	lobby.Members = append(lobby.Members[:i], lobby.Members[i+1:]...)
+
+	switch {
+	case len(lobby.Members) == 0:
+		lobby.Status = models.LobbyClosed
+	case lobby.HostID == playerID:
+		lobby.HostID = lobby.Members[0].PlayerID
+	default:
+		return nil
+	}
+	return tx.Omit(clause.Associations).Save(lobby).Error
+}
+
+// setReady records whether a lobby member is ready to start.
+func setReady(lobbyID, playerID uint, ready bool) (models.Lobby, error) {
+	return updateLobby(lobbyID, playerID, func(tx *gorm.DB, lobby *models.Lobby) error {
+		member := &lobby.Members[lobbyMember(*lobby, playerID)]
+		member.Ready = ready
+		return tx.Model(member).Update("ready", ready).Error
+	})
+}
+
+// sendLobbyChat stores a chat message and sends it to everyone in the lobby.
+func sendLobbyChat(lobbyID, playerID uint, message string) (models.LobbyChat, error) {
+	message = strings.TrimSpace(message)
+	if message == "" || len(message) > maxLobbyChatLength {
+		return models.LobbyChat{}, &InstanceError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Messages must be between 1 and %d characters", maxLobbyChatLength)}
+	}
+
+	var lobby models.Lobby
+	if err := db.Preload("Members").First(&lobby, lobbyID).Error; err != nil {
+		return models.LobbyChat{}, &InstanceError{Status: http.StatusNotFound, Message: "Lobby not found"}
+	}
+	if lobbyMember(lobby, playerID) == -1 {
+		return models.LobbyChat{}, &InstanceError{Status: http.StatusForbidden, Message: "Not a member of this lobby"}
+	}
+
+	chat := models.LobbyChat{LobbyID: lobbyID, UserID: playerID, Message: message, Timestamp: time.Now()}
+	if err := db.Create(&chat).Error; err != nil {
+		return chat, err
+	}
+
+	payload, _ := json.Marshal(chat)
+	hub.Broadcast(LobbyRoomID(lobbyID), WSMessage{Type: MessageLobbyChat, PlayerID: playerID, Payload: payload}, 0)
+	return chat, nil
+}
+
+// broadcastLobbyUpdate sends the lobby to everyone connected to its room.
+func broadcastLobbyUpdate(lobby models.Lobby) {
+	payload, err := json.Marshal(lobby)
+	if err != nil {
+		return
+	}
+	hub.Broadcast(LobbyRoomID(lobby.ID), WSMessage{Type: MessageLobbyUpdated, Payload: payload}, 0)
+}
+
+// decodeLobbyRequest decodes a lobby request body and the lobby ID from the path,
+// writing the error response if either is invalid.
+func decodeLobbyRequest(w http.ResponseWriter, r *http.Request, v interface{}) (uint, bool) {
+	lobbyID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid lobby ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if v != nil {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return 0, false
+		}
+	}
+	return lobbyID, true
+}
+
+// writeLobby writes the lobby as the response, or the error if the operation failed.
+func writeLobby(w http.ResponseWriter, lobby models.Lobby, err error, fallback string) {
+	if err != nil {
+		writeInstanceError(w, err, fallback)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lobby)
+}
+
+// CreateLobby creates a lobby hosted by the authenticated player.
+func CreateLobby(w http.ResponseWriter, r *http.Request) {
+	hostID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var settings lobbySettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := validateLobbySettings(&settings, 1); err != nil {
+		writeInstanceError(w, err, "Failed to create lobby")
+		return
+	}
+
+	lobby := models.Lobby{
+		Name:       settings.Name,
+		HostID:     hostID,
+		IsPrivate:  settings.IsPrivate,
+		MaxPlayers: settings.MaxPlayers,
+		Settings:   settings.Settings,
+		Status:     models.LobbyOpen,
+		Members:    []models.LobbyMember{{PlayerID: hostID, JoinedAt: time.Now()}},
+	}
+
+	// Retry on the rare code collision
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		if lobby.Code, err = newLobbyCode(); err != nil {
+			break
+		}
+		var taken int64
+		db.Model(&models.Lobby{}).Where("code = ?", lobby.Code).Count(&taken)
+		if taken == 0 {
+			err = db.Create(&lobby).Error
+			break
+		}
+		err = errors.New("no unique lobby code found")
+	}
+	if err != nil {
+		http.Error(w, "Failed to create lobby", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(lobby)
+}
+
+// ListLobbies returns the open public lobbies, newest first.
+func ListLobbies(w http.ResponseWriter, r *http.Request) {
+	lobbies := []models.Lobby{}
+	if err := db.Preload("Members").
+		Where("status = ? AND is_private = ?", models.LobbyOpen, false).
+		Order("created_at DESC").
+		Limit(maxLeaderboardLimit).
+		Find(&lobbies).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lobbies)
+}
+
+// GetLobby returns a lobby. Private lobbies are only visible to their members.
+func GetLobby(w http.ResponseWriter, r *http.Request) {
+	lobbyID, ok := decodeLobbyRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var lobby models.Lobby
+	if err := db.Preload("Members").First(&lobby, lobbyID).Error; err != nil || (lobby.IsPrivate && lobbyMember(lobby, playerID) == -1) {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lobby)
+}
+
+// JoinLobby adds the authenticated player to a public lobby by ID.
+func JoinLobby(w http.ResponseWriter, r *http.Request) {
+	lobbyID, ok := decodeLobbyRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	lobby, err := joinLobby(playerID, func(tx *gorm.DB) (uint, error) {
+		var target models.Lobby
+		if err := tx.First(&target, lobbyID).Error; err != nil || target.IsPrivate {
+			return 0, &InstanceError{Status: http.StatusNotFound, Message: "Lobby not found"}
+		}
+		return target.ID, nil
+	})
+	writeLobby(w, lobby, err, "Failed to join lobby")
+}
+
+// JoinLobbyByCode adds the authenticated player to the lobby with the given join code.
+func JoinLobbyByCode(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var joinRequest struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&joinRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	lobby, err := joinLobby(playerID, func(tx *gorm.DB) (uint, error) {
+		var target models.Lobby
+		if err := tx.Where("code = ?", strings.ToUpper(strings.TrimSpace(joinRequest.Code))).First(&target).Error; err != nil {
+			return 0, &InstanceError{Status: http.StatusNotFound, Message: "No lobby with that code"}
+		}
+		return target.ID, nil
+	})
+	writeLobby(w, lobby, err, "Failed to join lobby")
+}
+
+// joinLobby adds a player to the lobby picked by find, if it is open and has room.
+func joinLobby(playerID uint, find func(tx *gorm.DB) (uint, error)) (models.Lobby, error) {
+	var lobby models.Lobby
+	err := db.Transaction(func(tx *gorm.DB) error {
+		lobbyID, err := find(tx)
+		if err != nil {
+			return err
+		}
+		lobby, err = lockLobby(tx, lobbyID)
+		if err != nil {
+			return err
+		}
+		if lobby.Status != models.LobbyOpen {
+			return &InstanceError{Status: http.StatusConflict, Message: "Lobby is no longer open"}
+		}
+		if lobbyMember(lobby, playerID) != -1 {
+			return &InstanceError{Status: http.StatusConflict, Message: "Already in this lobby"}
+		}
+		if len(lobby.Members) >= lobby.MaxPlayers {
+			return &InstanceError{Status: http.StatusConflict, Message: "Lobby is full"}
+		}
+
+		member := models.LobbyMember{LobbyID: lobby.ID, PlayerID: playerID, JoinedAt: time.Now()}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		lobby.Members = append(lobby.Members, member)
+		return nil
+	})
+	if err != nil {
+		return lobby, err
+	}
+
+	broadcastLobbyUpdate(lobby)
+	return lobby, nil
+}
+
+// LeaveLobby takes the authenticated player out of a lobby.
+func LeaveLobby(w http.ResponseWriter, r *http.Request) {
+	lobbyID, ok := decodeLobbyRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	lobby, err := updateLobby(lobbyID, playerID, func(tx *gorm.DB, lobby *models.Lobby) error {
+		return removeLobbyMember(tx, lobby, playerID)
+	})
+	if err == nil {
+		hub.Evict(LobbyRoomID(lobbyID), playerID)
+	}
+	writeLobby(w, lobby, err, "Failed to leave lobby")
+}
+
+// KickFromLobby lets the host remove a player from the lobby.
+func KickFromLobby(w http.ResponseWriter, r *http.Request) {
+	var kickRequest struct {
+		PlayerID uint `json:"player_id"`
+	}
+	lobbyID, ok := decodeLobbyRequest(w, r, &kickRequest)
+	if !ok {
+		return
+	}
+	hostID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+	if kickRequest.PlayerID == hostID {
+		http.Error(w, "The host cannot kick themselves", http.StatusBadRequest)
+		return
+	}
+
+	lobby, err := updateLobby(lobbyID, hostID, func(tx *gorm.DB, lobby *models.Lobby) error {
+		if err := requireHost(lobby, hostID); err != nil {
+			return err
+		}
+		return removeLobbyMember(tx, lobby, kickRequest.PlayerID)
+	})
+	if err == nil {
+		sendToPlayer(kickRequest.PlayerID, WSMessage{Type: MessageLobbyKicked, PlayerID: kickRequest.PlayerID})
+		hub.Evict(LobbyRoomID(lobbyID), kickRequest.PlayerID)
+	}
+	writeLobby(w, lobby, err, "Failed to kick player")
+}
+
+// TransferLobbyHost lets the host hand the lobby over to another member.
+func TransferLobbyHost(w http.ResponseWriter, r *http.Request) {
+	var transferRequest struct {
+		PlayerID uint `json:"player_id"`
+	}
+	lobbyID, ok := decodeLobbyRequest(w, r, &transferRequest)
+	if !ok {
+		return
+	}
+	hostID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	lobby, err := updateLobby(lobbyID, hostID, func(tx *gorm.DB, lobby *models.Lobby) error {
+		if err := requireHost(lobby, hostID); err != nil {
+			return err
+		}
+		if lobbyMember(*lobby, transferRequest.PlayerID) == -1 {
+			return &InstanceError{Status: http.StatusNotFound, Message: "Player is not in this lobby"}
+		}
+		lobby.HostID = transferRequest.PlayerID
+		return tx.Omit(clause.Associations).Save(lobby).Error
+	})
+	writeLobby(w, lobby, err, "Failed to transfer host")
+}
+
+// UpdateLobbySettings lets the host change the lobby's settings. Fields left out of the
+// request keep their current value. Everyone's ready flag is cleared so players confirm
+// the new settings.
+func UpdateLobbySettings(w http.ResponseWriter, r *http.Request) {
+	var update struct {
+		Name       *string         `json:"name"`
+		IsPrivate  *bool           `json:"is_private"`
+		MaxPlayers *int            `json:"max_players"`
+		Settings   json.RawMessage `json:"settings"`
+	}
+	lobbyID, ok := decodeLobbyRequest(w, r, &update)
+	if !ok {
+		return
+	}
+	hostID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	lobby, err := updateLobby(lobbyID, hostID, func(tx *gorm.DB, lobby *models.Lobby) error {
+		if err := requireHost(lobby, hostID); err != nil {
+			return err
+		}
+
+		settings := lobbySettings{Name: lobby.Name, IsPrivate: lobby.IsPrivate, MaxPlayers: lobby.MaxPlayers, Settings: lobby.Settings}
+		if update.Name != nil {
+			settings.Name = *update.Name
+		}
+		if update.IsPrivate != nil {
+			settings.IsPrivate = *update.IsPrivate
+		}
+		if update.MaxPlayers != nil {
+			settings.MaxPlayers = *update.MaxPlayers
+		}
+		if update.Settings != nil {
+			settings.Settings = update.Settings
+		}
+		if err := validateLobbySettings(&settings, len(lobby.Members)); err != nil {
+			return err
+		}
+
+		lobby.Name = settings.Name
+		lobby.IsPrivate = settings.IsPrivate
+		lobby.MaxPlayers = settings.MaxPlayers
+		lobby.Settings = settings.Settings
+		if err := tx.Omit(clause.Associations).Save(lobby).Error; err != nil {
+			return err
+		}
+
+		for i := range lobby.Members {
+			lobby.Members[i].Ready = false
+		}
+		return tx.Model(&models.LobbyMember{}).Where("lobby_id = ?", lobby.ID).Update("ready", false).Error
+	})
+	writeLobby(w, lobby, err, "Failed to update lobby")
+}
+
+// SetLobbyReady sets the authenticated player's ready flag.
+func SetLobbyReady(w http.ResponseWriter, r *http.Request) {
+	var readyRequest struct {
+		Ready bool `json:"ready"`
+	}
+	lobbyID, ok := decodeLobbyRequest(w, r, &readyRequest)
+	if !ok {
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	lobby, err := setReady(lobbyID, playerID, readyRequest.Ready)
+	writeLobby(w, lobby, err, "Failed to update ready flag")
+}
+
+// SendLobbyChat posts a chat message to a lobby.
+func SendLobbyChat(w http.ResponseWriter, r *http.Request) {
+	var chatRequest struct {
+		Message string `json:"message"`
+	}
+	lobbyID, ok := decodeLobbyRequest(w, r, &chatRequest)
+	if !ok {
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	chat, err := sendLobbyChat(lobbyID, playerID, chatRequest.Message)
+	if err != nil {
+		writeInstanceError(w, err, "Failed to send message")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(chat)
+}
+
+// GetLobbyChat returns the most recent chat messages of a lobby, oldest first.
+func GetLobbyChat(w http.ResponseWriter, r *http.Request) {
+	lobbyID, ok := decodeLobbyRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var lobby models.Lobby
+	if err := db.Preload("Members").First(&lobby, lobbyID).Error; err != nil || lobbyMember(lobby, playerID) == -1 {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	chats := []models.LobbyChat{}
+	if err := db.Where("lobby_id = ?", lobbyID).Order("timestamp DESC").Limit(lobbyChatHistorySize).Find(&chats).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for i, j := 0, len(chats)-1; i < j; i, j = i+1, j-1 {
+		chats[i], chats[j] = chats[j], chats[i]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(chats)
+}
+
+// StartLobby lets the host start the game once every other member is ready. The lobby's
+// members become the players of a new game instance, which starts straight away.
+func StartLobby(w http.ResponseWriter, r *http.Request) {
+	lobbyID, ok := decodeLobbyRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	hostID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var instance models.GameInstance
+	lobby, err := updateLobby(lobbyID, hostID, func(tx *gorm.DB, lobby *models.Lobby) error {
+		if err := requireHost(lobby, hostID); err != nil {
+			return err
+		}
+
+		playerIDs := make([]uint, 0, len(lobby.Members))
+		for _, member := range lobby.Members {
+			if !member.Ready && member.PlayerID != lobby.HostID {
+				return &InstanceError{Status: http.StatusConflict, Message: "Not every player is ready"}
+			}
+			playerIDs = append(playerIDs, member.PlayerID)
+		}
+
+		var err error
+		instance, err = newInstance(tx, lobby.HostID, lobby.MaxPlayers, lobby.ID, playerIDs)
+		if err != nil {
+			return err
+		}
+		if err := startInstance(tx, &instance); err != nil {
+			return err
+		}
+
+		lobby.Status = models.LobbyStarted
+		lobby.GameInstanceID = instance.ID
+		return tx.Omit(clause.Associations).Save(lobby).Error
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to start lobby")
+		return
+	}
+
+	payload, err := json.Marshal(instance)
+	if err != nil {
+		log.Printf("Failed to encode game instance %d: %v", instance.ID, err)
+	}
+	hub.Broadcast(LobbyRoomID(lobby.ID), WSMessage{Type: MessageLobbyStarted, GameInstanceID: instance.ID, Payload: payload}, 0)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(instance)
+}
+
+// handleLobbyReady handles a lobby_ready message received over the WebSocket.
+func handleLobbyReady(pc *PlayerConnection, lobbyID uint, message WSMessage) {
+	var readyRequest struct {
+		Ready bool `json:"ready"`
+	}
+	if lobbyID == 0 || json.Unmarshal(message.Payload, &readyRequest) != nil {
+		pc.Send(WSMessage{Type: MessageError, Error: "Invalid ready request"})
+		return
+	}
+	if _, err := setReady(lobbyID, pc.PlayerID, readyRequest.Ready); err != nil {
+		pc.Send(WSMessage{Type: MessageError, Error: err.Error()})
+	}
+}
+
+// handleLobbyChat handles a lobby_chat message received over the WebSocket.
+func handleLobbyChat(pc *PlayerConnection, lobbyID uint, message WSMessage) {
+	var chatRequest struct {
+		Message string `json:"message"`
+	}
+	if lobbyID == 0 || json.Unmarshal(message.Payload, &chatRequest) != nil {
+		pc.Send(WSMessage{Type: MessageError, Error: "Invalid chat message"})
+		return
+	}
+	if _, err := sendLobbyChat(lobbyID, pc.PlayerID, chatRequest.Message); err != nil {
+		pc.Send(WSMessage{Type: MessageError, Error: err.Error()})
+	}
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+
+	"drokkit/economy"
+	"drokkit/market"
+	"drokkit/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Market page sizes
+const (
+	defaultMarketLimit = 50
+	maxMarketLimit     = 100
+)
+
+// PriceLevel is the resting volume at one price in an order book.
+type PriceLevel struct {
+	Price  int `json:"price"`
+	Amount int `json:"amount"` // Units not filled yet
+	Orders int `json:"orders"`
+}
+
+// OrderBook is a game instance's open orders for a resource, best prices first.
+type OrderBook struct {
+	GameInstanceID uint         `json:"game_instance_id"`
+	Type           string       `json:"type"`
+	Bids           []PriceLevel `json:"bids"` // Buy orders, highest price first
+	Asks           []PriceLevel `json:"asks"` // Sell orders, lowest price first
+}
+
+// MarketOrderPage is a page of market orders, newest first.
+type MarketOrderPage struct {
+	Orders []models.MarketOrder `json:"orders"`
+	Next   uint                 `json:"next,omitempty"` // Pass as before to get the next page
+}
+
+// MarketTradePage is a page of market trades, newest first.
+type MarketTradePage struct {
+	Trades []models.MarketTrade `json:"trades"`
+	Next   uint                 `json:"next,omitempty"` // Pass as before to get the next page
+}
+
+// marketResource checks that a resource can be traded on the market. Everything but Gold,
+// which prices the market, can be.
+func marketResource(resourceType string) error {
+	if _, ok := economy.Lookup(resourceType); !ok {
+		return &InstanceError{Status: http.StatusBadRequest, Message: "Unknown resource type"}
+	}
+	if resourceType == economy.Gold {
+		return &InstanceError{Status: http.StatusBadRequest, Message: "Gold cannot be traded on the market"}
+	}
+	return nil
+}
+
+// orderHolds returns what an order holds from its player for the given number of units:
+// Gold for a buy order and the resource itself for a sell order.
+func orderHolds(order models.MarketOrder, units int) (string, int) {
+	if order.Side == market.Buy {
+		return economy.Gold, units * order.Price
+	}
+	return order.Type, units
+}
+
+// placeOrder adds an order to a game instance's market, holds what it could cost and fills
+// as much of it as possible against the resting orders.
+func placeOrder(playerID uint, order models.MarketOrder) (models.MarketOrder, []models.MarketOrder, []models.MarketTrade, error) {
+	var filled []models.MarketOrder
+	var trades []models.MarketTrade
+	err := db.Transaction(func(tx *gorm.DB) error {
+		instance, err := lockInstance(tx, order.GameInstanceID)
+		if err != nil {
+			return err
+		}
+		if !hasPlayer(instance, playerID) {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Not a player in this game instance"}
+		}
+		if instance.Status != models.InstanceActive {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+		}
+
+		order.PlayerID = playerID
+		order.Remaining = order.Amount
+		order.Status = models.OrderOpen
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		heldType, heldAmount := orderHolds(order, order.Amount)
+		if _, err := adjustResource(tx, instance.ID, playerID, heldType, -heldAmount, ledgerMarketHold, order.ID); err != nil {
+			return err
+		}
+
+		// The crossing orders on the other side of the book, locked in ID order
+		crosses := "price <= ?"
+		if order.Side == market.Sell {
+			crosses = "price >= ?"
+		}
+		var resting []models.MarketOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("game_instance_id = ? AND type = ? AND side = ? AND status = ? AND player_id <> ?", instance.ID, order.Type, market.Opposite(order.Side), models.OrderOpen, playerID).
+			Where(crosses, order.Price).
+			Order("id").
+			Find(&resting).Error; err != nil {
+			return err
+		}
+		book := make([]market.Order, len(resting))
+		byID := make(map[uint]*models.MarketOrder, len(resting))
+		for i := range resting {
+			book[i] = market.Order{ID: resting[i].ID, Side: resting[i].Side, Price: resting[i].Price, Remaining: resting[i].Remaining}
+			byID[resting[i].ID] = &resting[i]
+		}
+		market.SortBook(book)
+
+		rates := make(map[uint]float64)
+		rateOf := func(id uint) (float64, error) {
+			if rate, ok := rates[id]; ok {
+				return rate, nil
+			}
+			rate, err := tradeRate(tx, instance.ID, id)
+			rates[id] = rate
+			return rate, err
+		}
+
+		incoming := market.Order{ID: order.ID, Side: order.Side, Price: order.Price, Remaining: order.Remaining}
+		for _, fill := range market.Match(incoming, book) {
+			other := byID[fill.RestingID]
+			buy, sell := &order, other
+			if order.Side == market.Sell {
+				buy, sell = other, &order
+			}
+			buyerRate, err := rateOf(buy.PlayerID)
+			if err != nil {
+				return err
+			}
+			sellerRate, err := rateOf(sell.PlayerID)
+			if err != nil {
+				return err
+			}
+
+			buyerFee, sellerFee := fill.Fees(buyerRate, sellerRate)
+			trade := models.MarketTrade{
+				GameInstanceID: instance.ID,
+				Type:           order.Type,
+				Price:          fill.Price,
+				Amount:         fill.Amount,
+				BuyOrderID:     buy.ID,
+				SellOrderID:    sell.ID,
+				BuyerID:        buy.PlayerID,
+				SellerID:       sell.PlayerID,
+				BuyerFee:       buyerFee,
+				SellerFee:      sellerFee,
+			}
+			if err := tx.Create(&trade).Error; err != nil {
+				return err
+			}
+
+			// The buyer held Gold at their own price, so a cheaper fill returns the difference
+			_, err = adjustResources(tx, instance.ID, []resourceChange{
+				{PlayerID: buy.PlayerID, Type: order.Type, Delta: fill.Amount, Reason: ledgerMarketIn, ReferenceID: trade.ID},
+				{PlayerID: buy.PlayerID, Type: order.Type, Delta: -trade.BuyerFee, Reason: ledgerTradeFee, ReferenceID: trade.ID},
+				{PlayerID: buy.PlayerID, Type: economy.Gold, Delta: fill.Refund(buy.Price), Reason: ledgerMarketRefund, ReferenceID: buy.ID},
+				{PlayerID: sell.PlayerID, Type: economy.Gold, Delta: fill.Price * fill.Amount, Reason: ledgerMarketIn, ReferenceID: trade.ID},
+				{PlayerID: sell.PlayerID, Type: economy.Gold, Delta: -trade.SellerFee, Reason: ledgerTradeFee, ReferenceID: trade.ID},
+			})
+			if err != nil {
+				return err
+			}
+
+			order.Remaining -= fill.Amount
+			other.Remaining -= fill.Amount
+			if other.Remaining == 0 {
+				other.Status = models.OrderFilled
+			}
+			if err := tx.Model(other).Updates(map[string]interface{}{"remaining": other.Remaining, "status": other.Status}).Error; err != nil {
+				return err
+			}
+			filled = append(filled, *other)
+			trades = append(trades, trade)
+		}
+
+		if order.Remaining == 0 {
+			order.Status = models.OrderFilled
+		}
+		return tx.Model(&order).Updates(map[string]interface{}{"remaining": order.Remaining, "status": order.Status}).Error
+	})
+	return order, filled, trades, err
+}
+
+// notifyOrder tells a player that one of their market orders changed.
+func notifyOrder(order models.MarketOrder) {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		log.Printf("Failed to encode market order %d: %v", order.ID, err)
+		return
+	}
+	sendToPlayer(order.PlayerID, WSMessage{Type: MessageMarketOrderUpdated, GameInstanceID: order.GameInstanceID, Payload: payload})
+}
+
+// broadcastMarketTrade tells everyone connected to a game instance's room about a trade on its market.
+func broadcastMarketTrade(trade models.MarketTrade) {
+	payload, err := json.Marshal(trade)
+	if err != nil {
+		log.Printf("Failed to encode market trade %d: %v", trade.ID, err)
+		return
+	}
+	hub.Broadcast(InstanceRoomID(trade.GameInstanceID), WSMessage{Type: MessageMarketTrade, GameInstanceID: trade.GameInstanceID, Payload: payload}, 0)
+}
+
+// PlaceMarketOrder adds the authenticated player's order to buy or sell a resource for Gold
+// to a game instance's market.
+func PlaceMarketOrder(w http.ResponseWriter, r *http.Request) {
+	var orderRequest struct {
+		GameInstanceID uint   `json:"game_instance_id"`
+		Side           string `json:"side"`
+		Type           string `json:"type"`
+		Price          int    `json:"price"`
+		Amount         int    `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&orderRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if orderRequest.Side != market.Buy && orderRequest.Side != market.Sell {
+		http.Error(w, "side must be Buy or Sell", http.StatusBadRequest)
+		return
+	}
+	if err := marketResource(orderRequest.Type); err != nil {
+		writeInstanceError(w, err, "Invalid resource type")
+		return
+	}
+	if orderRequest.Price <= 0 || orderRequest.Amount <= 0 {
+		http.Error(w, "price and amount must be positive", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	order, filled, trades, err := placeOrder(playerID, models.MarketOrder{
+		GameInstanceID: orderRequest.GameInstanceID,
+		Side:           orderRequest.Side,
+		Type:           orderRequest.Type,
+		Price:          orderRequest.Price,
+		Amount:         orderRequest.Amount,
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to place market order")
+		return
+	}
+	for _, trade := range trades {
+		broadcastMarketTrade(trade)
+	}
+	for _, other := range filled {
+		notifyOrder(other)
+	}
+	invalidateTeamBoards(order.GameInstanceID)
+	checkVictory(order.GameInstanceID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// CancelMarketOrder withdraws the unfilled part of the authenticated player's open order
+// and returns what it still held.
+func CancelMarketOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid market order ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var order models.MarketOrder
+	if err := db.First(&order, orderID).Error; err != nil || order.PlayerID != playerID {
+		http.Error(w, "Market order not found", http.StatusNotFound)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the instance first, as placing an order does
+		if _, err := lockInstance(tx, order.GameInstanceID); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		if order.Status != models.OrderOpen {
+			return &InstanceError{Status: http.StatusConflict, Message: "Market order is " + order.Status}
+		}
+
+		heldType, heldAmount := orderHolds(order, order.Remaining)
+		if _, err := adjustResource(tx, order.GameInstanceID, playerID, heldType, heldAmount, ledgerMarketRefund, order.ID); err != nil {
+			return err
+		}
+		order.Status = models.OrderCancelled
+		return tx.Model(&order).Update("status", order.Status).Error
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to cancel market order")
+		return
+	}
+	invalidateTeamBoards(order.GameInstanceID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
+
+// GetOrderBook returns the open orders for a resource on a game instance's market,
+// grouped by price.
+func GetOrderBook(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	resourceType := r.URL.Query().Get("type")
+	if err := marketResource(resourceType); err != nil {
+		writeInstanceError(w, err, "Invalid resource type")
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+	if !isInstancePlayer(instanceID, playerID) {
+		http.Error(w, "Not a player in this game instance", http.StatusForbidden)
+		return
+	}
+
+	var levels []struct {
+		Side string
+		PriceLevel
+	}
+	if err := db.Model(&models.MarketOrder{}).
+		Select("side, price, SUM(remaining) AS amount, COUNT(*) AS orders").
+		Where("game_instance_id = ? AND type = ? AND status = ?", instanceID, resourceType, models.OrderOpen).
+		Group("side, price").
+		Scan(&levels).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	book := OrderBook{GameInstanceID: instanceID, Type: resourceType, Bids: []PriceLevel{}, Asks: []PriceLevel{}}
+	for _, level := range levels {
+		if level.Side == market.Buy {
+			book.Bids = append(book.Bids, level.PriceLevel)
+		} else {
+			book.Asks = append(book.Asks, level.PriceLevel)
+		}
+	}
+	sort.Slice(book.Bids, func(i, j int) bool { return book.Bids[i].Price > book.Bids[j].Price })
+	sort.Slice(book.Asks, func(i, j int) bool { return book.Asks[i].Price < book.Asks[j].Price })
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(book)
+}
+
+// ListMarketOrders returns the authenticated player's orders on a game instance's market,
+// newest first.
+func ListMarketOrders(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	query := db.Where("game_instance_id = ? AND player_id = ?", instanceID, playerID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if before := queryInt(r, "before", 0); before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	limit := queryInt(r, "limit", defaultMarketLimit)
+	if limit == 0 || limit > maxMarketLimit {
+		limit = maxMarketLimit
+	}
+
+	page := MarketOrderPage{Orders: []models.MarketOrder{}}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&page.Orders).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(page.Orders) > limit {
+		page.Orders = page.Orders[:limit]
+		page.Next = page.Orders[limit-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// ListMarketTrades returns the trades made on a game instance's market, newest first.
+func ListMarketTrades(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+	if !isInstancePlayer(instanceID, playerID) {
+		http.Error(w, "Not a player in this game instance", http.StatusForbidden)
+		return
+	}
+
+	query := db.Where("game_instance_id = ?", instanceID)
+	if resourceType := r.URL.Query().Get("type"); resourceType != "" {
+		query = query.Where("type = ?", resourceType)
+	}
+	if before := queryInt(r, "before", 0); before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	limit := queryInt(r, "limit", defaultMarketLimit)
+	if limit == 0 || limit > maxMarketLimit {
+		limit = maxMarketLimit
+	}
+
+	page := MarketTradePage{Trades: []models.MarketTrade{}}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&page.Trades).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(page.Trades) > limit {
+		page.Trades = page.Trades[:limit]
+		page.Next = page.Trades[limit-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
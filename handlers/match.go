@@ -3,20 +3,31 @@ package handlers
 
 import (
 	"drokkit/models"
+	"drokkit/rules"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // GameState represents the state of the game within a match.
 type GameState struct {
-	TurnCount int          `json:"turn_count"`
-	Moves     []PlayerMove `json:"moves"` // Record of moves in the game
+	TurnCount int             `json:"turn_count"`
+	Moves     []PlayerMove    `json:"moves"`            // Record of moves in the game
+	Data      json.RawMessage `json:"data,omitempty"`   // Ruleset-specific state
+	Result    *rules.Result   `json:"result,omitempty"` // Set once the ruleset reports the game over
 }
 
 // PlayerMove represents a single move by a player.
 type PlayerMove struct {
-	PlayerID uint   `json:"player_id"`
-	Action   string `json:"action"`
+	PlayerID uint            `json:"player_id"`
+	Action   string          `json:"action"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
 }
 
 // CreateMatch initiates a match between two players with an initial game state.
@@ -27,36 +38,316 @@ func CreateMatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The caller must be one of the players; an omitted player one defaults to the caller
+	callerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+	if match.PlayerOne == 0 {
+		match.PlayerOne = callerID
+	}
+	if match.PlayerOne != callerID && match.PlayerTwo != callerID {
+		http.Error(w, "Cannot create a match for other players", http.StatusForbidden)
+		return
+	}
+
+	if match.PlayerOne == 0 || match.PlayerTwo == 0 || match.PlayerOne == match.PlayerTwo {
+		http.Error(w, "A match requires two different players", http.StatusBadRequest)
+		return
+	}
+
+	match, err := newMatch(match.PlayerOne, match.PlayerTwo, match.GameType)
+	if err != nil {
+		var matchErr *MatchError
+		if errors.As(err, &matchErr) {
+			http.Error(w, matchErr.Message, matchErr.Status)
+			return
+		}
+		http.Error(w, "Failed to create match", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(match)
+}
+
+// newMatch creates a pending match between two players with the initial state of the game type's ruleset.
+func newMatch(playerOne, playerTwo uint, gameType string) (models.Match, error) {
+	match := models.Match{
+		PlayerOne: playerOne,
+		PlayerTwo: playerTwo,
+		GameType:  gameType,
+	}
+
+	// Select the ruleset for the requested game type
+	if match.GameType == "" {
+		match.GameType = rules.DefaultGameType
+	}
+	ruleSet, err := rules.Get(match.GameType)
+	if err != nil {
+		return match, &MatchError{Status: http.StatusBadRequest, Message: "Unknown game type"}
+	}
+
+	data, err := ruleSet.NewState([]uint{match.PlayerOne, match.PlayerTwo})
+	if err != nil {
+		return match, &MatchError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
 	// Initialize the game state
 	initialGameState := GameState{
 		TurnCount: 1,
 		Moves:     []PlayerMove{},
+		Data:      data,
 	}
 
 	// Serialize initial game state into JSON
 	gameStateData, err := json.Marshal(initialGameState)
 	if err != nil {
-		http.Error(w, "Failed to create game state", http.StatusInternalServerError)
-		return
+		return match, &MatchError{Status: http.StatusInternalServerError, Message: "Failed to create game state"}
 	}
 	match.GameState = gameStateData
+	match.Turn = 1 // Player one moves first
+	match.Status = models.MatchPending
 
 	// Insert the match into the database
 	if err := db.Create(&match).Error; err != nil {
-		http.Error(w, "Failed to create match", http.StatusInternalServerError)
+		return match, &MatchError{Status: http.StatusInternalServerError, Message: "Failed to create match"}
+	}
+	return match, nil
+}
+
+// MatchError describes why a match operation was rejected and the HTTP status it maps to.
+type MatchError struct {
+	Status  int
+	Message string
+}
+
+func (e *MatchError) Error() string {
+	return e.Message
+}
+
+// currentPlayer returns the ID of the player whose turn it is.
+func currentPlayer(match models.Match) uint {
+	if match.Turn == 2 {
+		return match.PlayerTwo
+	}
+	return match.PlayerOne
+}
+
+// matchTransitions lists the lifecycle states a match may move to from each state.
+var matchTransitions = map[string][]string{
+	models.MatchPending: {models.MatchActive, models.MatchAbandoned},
+	models.MatchActive:  {models.MatchFinished, models.MatchAbandoned},
+}
+
+// transitionMatch moves the match to a new lifecycle state if the transition is allowed.
+func transitionMatch(match *models.Match, status string) error {
+	from := match.Status
+	if from == "" {
+		from = models.MatchPending // Matches created before lifecycle states existed
+	}
+
+	for _, next := range matchTransitions[from] {
+		if next == status {
+			match.Status = status
+			return nil
+		}
+	}
+	return &MatchError{Status: http.StatusConflict, Message: fmt.Sprintf("Match cannot move from %s to %s", from, status)}
+}
+
+// endMatch moves the match to a final state, records the winner and updates both players' stats and ratings.
+func endMatch(tx *gorm.DB, match *models.Match, status string, winnerID uint) error {
+	if err := transitionMatch(match, status); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	match.WinnerID = winnerID
+	match.FinishedAt = &now
+
+	if err := recordMatchStats(tx, *match); err != nil {
+		return &MatchError{Status: http.StatusInternalServerError, Message: "Failed to update player stats"}
+	}
+	if err := recordMatchRatings(tx, *match); err != nil {
+		return &MatchError{Status: http.StatusInternalServerError, Message: "Failed to update player ratings"}
+	}
+	return nil
+}
+
+// broadcastMatchOver tells everyone in the match room how the match ended.
+func broadcastMatchOver(match models.Match) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"status":    match.Status,
+		"winner_id": match.WinnerID,
+	})
+	if err != nil {
 		return
 	}
+	hub.Broadcast(MatchRoomID(match.ID), WSMessage{Type: MessageMatchOver, MatchID: match.ID, Payload: payload}, 0)
+}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(match)
+// playerView returns a copy of the match with the game state reduced to what the
+// given player is allowed to see under the match's ruleset.
+func playerView(match models.Match, playerID uint) (models.Match, error) {
+	ruleSet, err := rules.Get(match.GameType)
+	if err != nil {
+		return match, err
+	}
+
+	var gameState GameState
+	if err := json.Unmarshal(match.GameState, &gameState); err != nil {
+		return match, err
+	}
+	if gameState.Data != nil {
+		if gameState.Data, err = ruleSet.PlayerView(gameState.Data, playerID); err != nil {
+			return match, err
+		}
+	}
+
+	view, err := json.Marshal(gameState)
+	if err != nil {
+		return match, err
+	}
+	match.GameState = view
+	return match, nil
+}
+
+// broadcastMatchState sends every member of the match room their own view of the game state.
+func broadcastMatchState(match models.Match) {
+	for _, pc := range hub.Members(MatchRoomID(match.ID)) {
+		view, err := playerView(match, pc.PlayerID)
+		if err != nil {
+			continue
+		}
+		pc.Send(WSMessage{Type: MessageState, MatchID: match.ID, Payload: view.GameState})
+	}
+}
+
+// applyTurn is the authoritative turn pipeline shared by the REST and WebSocket APIs.
+// It validates that it is the player's turn, delegates the move to the match's ruleset,
+// persists the match and only then broadcasts the accepted move and new state to the match room.
+func applyTurn(matchID, playerID uint, move rules.Move) (*models.Match, error) {
+	var match models.Match
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the match row so concurrent submissions cannot both pass the turn check
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&match, matchID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &MatchError{Status: http.StatusNotFound, Message: "Match not found"}
+			}
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Database error"}
+		}
+
+		// Validate the player's turn
+		if match.PlayerOne != playerID && match.PlayerTwo != playerID {
+			return &MatchError{Status: http.StatusForbidden, Message: "Not a participant in this match"}
+		}
+		switch match.Status {
+		case models.MatchFinished:
+			return &MatchError{Status: http.StatusConflict, Message: "Match is finished"}
+		case models.MatchAbandoned:
+			return &MatchError{Status: http.StatusConflict, Message: "Match was abandoned"}
+		}
+		if currentPlayer(match) != playerID {
+			return &MatchError{Status: http.StatusForbidden, Message: "Not your turn"}
+		}
+
+		ruleSet, err := rules.Get(match.GameType)
+		if err != nil {
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Unknown game type"}
+		}
+
+		// Deserialize the existing game state
+		var gameState GameState
+		if err := json.Unmarshal(match.GameState, &gameState); err != nil {
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Failed to parse game state"}
+		}
+
+		// Let the ruleset validate and apply the move
+		if err := ruleSet.ValidateMove(gameState.Data, playerID, move); err != nil {
+			return &MatchError{Status: http.StatusBadRequest, Message: "Invalid move: " + err.Error()}
+		}
+		if gameState.Data, err = ruleSet.ApplyMove(gameState.Data, playerID, move); err != nil {
+			return &MatchError{Status: http.StatusBadRequest, Message: "Invalid move: " + err.Error()}
+		}
+
+		// Record the move in the match history
+		newMove := PlayerMove{
+			PlayerID: playerID,
+			Action:   move.Action,
+			Payload:  move.Payload,
+		}
+		gameState.Moves = append(gameState.Moves, newMove)
+		gameState.TurnCount++
+
+		result, err := ruleSet.Result(gameState.Data)
+		if err != nil {
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Failed to evaluate game state"}
+		}
+		if result.Over {
+			gameState.Result = &result
+		}
+
+		// The first accepted turn starts the match; a finished game ends it
+		if match.Status != models.MatchActive {
+			if err := transitionMatch(&match, models.MatchActive); err != nil {
+				return err
+			}
+		}
+		if result.Over {
+			if err := endMatch(tx, &match, models.MatchFinished, result.WinnerID); err != nil {
+				return err
+			}
+		}
+
+		// Reserialize the updated game state
+		updatedGameState, err := json.Marshal(gameState)
+		if err != nil {
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Failed to update game state"}
+		}
+		match.GameState = updatedGameState
+
+		// Toggle the turn between players
+		if match.Turn == 2 {
+			match.Turn = 1
+		} else {
+			match.Turn = 2
+		}
+
+		// Save the updated match state
+		if err := tx.Save(&match).Error; err != nil {
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Failed to save match state"}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Push the accepted move and the new state to everyone connected to the match room
+	hub.Broadcast(MatchRoomID(match.ID), WSMessage{Type: MessageMove, MatchID: match.ID, PlayerID: playerID, Action: move.Action, Payload: move.Payload}, 0)
+	broadcastMatchState(match)
+	if match.Status == models.MatchFinished {
+		recordLeaderboardResult(match)
+		broadcastMatchOver(match)
+	}
+
+	return &match, nil
 }
 
 // PlayTurn allows a player to submit their turn, updates game state, and saves it.
 func PlayTurn(w http.ResponseWriter, r *http.Request) {
+	matchID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid match ID", http.StatusBadRequest)
+		return
+	}
+
 	var turnData struct {
-		MatchID  uint   `json:"match_id"`
-		PlayerID uint   `json:"player_id"`
-		Action   string `json:"action"`
+		PlayerID uint            `json:"player_id"`
+		Action   string          `json:"action"`
+		Payload  json.RawMessage `json:"payload"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&turnData); err != nil {
@@ -64,52 +355,102 @@ func PlayTurn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch the match from the database
-	var match models.Match
-	if err := db.First(&match, turnData.MatchID).Error; err != nil {
-		http.Error(w, "Match not found", http.StatusNotFound)
+	playerID, ok := actingPlayer(w, r, turnData.PlayerID)
+	if !ok {
 		return
 	}
 
-	// Validate the player's turn
-	if (match.Turn == 1 && match.PlayerOne != turnData.PlayerID) ||
-		(match.Turn == 2 && match.PlayerTwo != turnData.PlayerID) {
-		http.Error(w, "Not your turn", http.StatusForbidden)
+	match, err := applyTurn(matchID, playerID, rules.Move{Action: turnData.Action, Payload: turnData.Payload})
+	if err != nil {
+		var matchErr *MatchError
+		if errors.As(err, &matchErr) {
+			http.Error(w, matchErr.Message, matchErr.Status)
+			return
+		}
+		http.Error(w, "Failed to play turn", http.StatusInternalServerError)
 		return
 	}
 
-	// Deserialize the existing game state
-	var gameState GameState
-	if err := json.Unmarshal(match.GameState, &gameState); err != nil {
-		http.Error(w, "Failed to parse game state", http.StatusInternalServerError)
+	view, err := playerView(*match, playerID)
+	if err != nil {
+		http.Error(w, "Failed to build game state", http.StatusInternalServerError)
 		return
 	}
 
-	// Update the game state with the new move
-	newMove := PlayerMove{
-		PlayerID: turnData.PlayerID,
-		Action:   turnData.Action,
-	}
-	gameState.Moves = append(gameState.Moves, newMove)
-	gameState.TurnCount++
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(view)
+}
 
-	// Reserialize the updated game state
-	updatedGameState, err := json.Marshal(gameState)
+// AbandonMatch lets a participant walk away from a match. Abandoning a match that is
+// already under way forfeits it, so the opponent is recorded as the winner.
+func AbandonMatch(w http.ResponseWriter, r *http.Request) {
+	matchID, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, "Failed to update game state", http.StatusInternalServerError)
+		http.Error(w, "Invalid match ID", http.StatusBadRequest)
+		return
+	}
+
+	var abandonRequest struct {
+		PlayerID uint `json:"player_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&abandonRequest); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	playerID, ok := actingPlayer(w, r, abandonRequest.PlayerID)
+	if !ok {
 		return
 	}
-	match.GameState = updatedGameState
 
-	// Toggle the turn between players
-	match.Turn = 1 + (match.Turn % 2)
+	var match models.Match
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&match, matchID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &MatchError{Status: http.StatusNotFound, Message: "Match not found"}
+			}
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Database error"}
+		}
+
+		if match.PlayerOne != playerID && match.PlayerTwo != playerID {
+			return &MatchError{Status: http.StatusForbidden, Message: "Not a participant in this match"}
+		}
 
-	// Save the updated match state
-	if err := db.Save(&match).Error; err != nil {
-		http.Error(w, "Failed to save match state", http.StatusInternalServerError)
+		// A match that never started has no winner and does not count towards stats
+		if match.Status == models.MatchPending || match.Status == "" {
+			if err := transitionMatch(&match, models.MatchAbandoned); err != nil {
+				return err
+			}
+			now := time.Now()
+			match.FinishedAt = &now
+		} else {
+			winnerID := match.PlayerOne
+			if playerID == match.PlayerOne {
+				winnerID = match.PlayerTwo
+			}
+			if err := endMatch(tx, &match, models.MatchAbandoned, winnerID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Save(&match).Error; err != nil {
+			return &MatchError{Status: http.StatusInternalServerError, Message: "Failed to save match state"}
+		}
+		return nil
+	})
+	if err != nil {
+		var matchErr *MatchError
+		if errors.As(err, &matchErr) {
+			http.Error(w, matchErr.Message, matchErr.Status)
+			return
+		}
+		http.Error(w, "Failed to abandon match", http.StatusInternalServerError)
 		return
 	}
 
+	recordLeaderboardResult(match)
+	broadcastMatchOver(match)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(match)
 }
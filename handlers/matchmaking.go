@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"drokkit/matchmaking"
+	"drokkit/models"
+	"drokkit/rating"
+	"drokkit/rules"
+)
+
+// matchmakingInterval is how often the matchmaker looks for pairs
+const matchmakingInterval = 1 * time.Second
+
+var matchmaker *matchmaking.Service
+
+func init() {
+	// Set up here rather than in the declaration because onMatchFound refers back to matchmaker
+	matchmaker = matchmaking.NewService(matchmaking.NewMemoryQueue(), matchmaking.RealClock{}, matchmaking.DefaultWindow, onMatchFound)
+}
+
+// queueRequest is the body of a matchmaking request, over REST or WebSocket.
+type queueRequest struct {
+	GameType    string                  `json:"game_type"`
+	Preferences matchmaking.Preferences `json:"preferences"`
+}
+
+// StartMatchmaking runs the background matchmaking worker until stop is closed.
+func StartMatchmaking(stop <-chan struct{}) {
+	go matchmaker.Run(matchmakingInterval, stop)
+}
+
+// playerRating is the skill value used to pair players in matchmaking.
+func playerRating(playerID uint, gameType string) int {
+	var r models.Rating
+	if err := db.Where("player_id = ? AND game_type = ?", playerID, gameType).First(&r).Error; err != nil {
+		return rating.Initial
+	}
+	return r.Rating
+}
+
+// enqueuePlayer validates a queue request and adds the player to the matchmaking queue.
+func enqueuePlayer(playerID uint, request queueRequest) (matchmaking.Ticket, error) {
+	if request.GameType == "" {
+		request.GameType = rules.DefaultGameType
+	}
+	if _, err := rules.Get(request.GameType); err != nil {
+		return matchmaking.Ticket{}, &MatchError{Status: http.StatusBadRequest, Message: "Unknown game type"}
+	}
+
+	ticket, err := matchmaker.Enqueue(matchmaking.Ticket{
+		PlayerID:    playerID,
+		GameType:    request.GameType,
+		Rating:      playerRating(playerID, request.GameType),
+		Preferences: request.Preferences,
+	})
+	if errors.Is(err, matchmaking.ErrAlreadyQueued) {
+		return ticket, &MatchError{Status: http.StatusConflict, Message: "Already queued"}
+	}
+	return ticket, err
+}
+
+// onMatchFound creates the match for a pair found by the matchmaker and tells both players.
+func onMatchFound(pair matchmaking.Pair) {
+	match, err := newMatch(pair.First.PlayerID, pair.Second.PlayerID, pair.First.GameType)
+	if err != nil {
+		log.Printf("Failed to create match for players %d and %d: %v", pair.First.PlayerID, pair.Second.PlayerID, err)
+		// Put both players back without losing their place
+		matchmaker.Requeue(pair.First)
+		matchmaker.Requeue(pair.Second)
+		return
+	}
+
+	payload, err := json.Marshal(match)
+	if err != nil {
+		return
+	}
+	for _, playerID := range []uint{match.PlayerOne, match.PlayerTwo} {
+		sendToPlayer(playerID, WSMessage{Type: MessageMatchFound, MatchID: match.ID, Payload: payload})
+	}
+}
+
+// JoinQueue puts the authenticated player in the matchmaking queue.
+func JoinQueue(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var request queueRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	ticket, err := enqueuePlayer(playerID, request)
+	if err != nil {
+		var matchErr *MatchError
+		if errors.As(err, &matchErr) {
+			http.Error(w, matchErr.Message, matchErr.Status)
+			return
+		}
+		http.Error(w, "Failed to join queue", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// LeaveQueue takes the authenticated player out of the matchmaking queue.
+func LeaveQueue(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	if !matchmaker.Leave(playerID) {
+		http.Error(w, "Not queued", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Left queue"})
+}
+
+// GetQueueStatus reports the authenticated player's ticket and current search window.
+func GetQueueStatus(w http.ResponseWriter, r *http.Request) {
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	ticket, gap, queued := matchmaker.Status(playerID)
+	if !queued {
+		http.Error(w, "Not queued", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket":         ticket,
+		"rating_gap":     gap,
+		"waited_seconds": int(matchmaker.Waited(ticket).Seconds()),
+	})
+}
+
+// handleQueueJoin handles a queue_join message received over the WebSocket.
+func handleQueueJoin(pc *PlayerConnection, message WSMessage) {
+	var request queueRequest
+	if len(message.Payload) > 0 {
+		if err := json.Unmarshal(message.Payload, &request); err != nil {
+			pc.Send(WSMessage{Type: MessageError, Error: "Invalid queue request"})
+			return
+		}
+	}
+
+	ticket, err := enqueuePlayer(pc.PlayerID, request)
+	if err != nil {
+		pc.Send(WSMessage{Type: MessageError, Error: err.Error()})
+		return
+	}
+
+	payload, _ := json.Marshal(ticket)
+	pc.Send(WSMessage{Type: MessageQueueJoined, PlayerID: pc.PlayerID, Payload: payload})
+}
+
+// handleQueueLeave handles a queue_leave message received over the WebSocket.
+func handleQueueLeave(pc *PlayerConnection) {
+	if !matchmaker.Leave(pc.PlayerID) {
+		pc.Send(WSMessage{Type: MessageError, Error: "Not queued"})
+		return
+	}
+	pc.Send(WSMessage{Type: MessageQueueLeft, PlayerID: pc.PlayerID})
+}
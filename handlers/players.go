@@ -6,7 +6,8 @@ import (
 	"time"
 
 	"drokkit/models"
-	"github.com/golang-jwt/jwt/v4"
+	"drokkit/sessions"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -56,17 +57,59 @@ func LoginPlayer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	expirationTime := time.Now().Add(1 * time.Hour)
-	claims := &Claims{
-		Username: credentials.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	// Start a new session and generate its tokens
+	session := sessions.Session{
+		ID:        uuid.New().String(),
+		PlayerID:  player.ID,
+		Username:  player.Username,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	tokens, err := issueTokens(player, session)
+	if err != nil {
+		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:    "token",
+		Value:   tokens.Token,
+		Expires: tokens.ExpiresAt,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and refresh token.
+// Refresh tokens are single use; the one presented is invalidated.
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&refreshRequest); err != nil || refreshRequest.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	session, err := sessionStore.ConsumeRefreshToken(refreshRequest.RefreshToken)
+	if err != nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(JwtKey)
+	revoked, err := sessionStore.IsRevoked(session.ID)
+	if err != nil || revoked {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	var player models.Player
+	if err := db.First(&player, session.PlayerID).Error; err != nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := issueTokens(player, session)
 	if err != nil {
 		http.Error(w, "Could not create token", http.StatusInternalServerError)
 		return
@@ -74,10 +117,36 @@ func LoginPlayer(w http.ResponseWriter, r *http.Request) {
 
 	http.SetCookie(w, &http.Cookie{
 		Name:    "token",
-		Value:   tokenString,
-		Expires: expirationTime,
+		Value:   tokens.Token,
+		Expires: tokens.ExpiresAt,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// LogoutPlayer revokes the current session so its access and refresh tokens stop working,
+// and closes the WebSocket connections opened with it.
+func LogoutPlayer(w http.ResponseWriter, r *http.Request) {
+	player, ok := PlayerFromContext(r.Context())
+	if !ok || player.SessionID == "" {
+		http.Error(w, "No session to log out of", http.StatusBadRequest)
+		return
+	}
+
+	if err := sessionStore.Revoke(player.SessionID, time.Now().Add(refreshTokenTTL)); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	closeSession(player.SessionID)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:    "token",
+		Value:   "",
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
 	})
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
 }
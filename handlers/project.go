@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"drokkit/models"
+	"drokkit/projects"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Project queue settings
+const (
+	maxQueuedProjects  = 5           // Unfinished projects per queue
+	projectSweepPeriod = time.Minute // Longest the scheduler sleeps between checks
+)
+
+// projectWake tells the project scheduler that the queues changed.
+var projectWake = make(chan struct{}, 1)
+
+// StartProjects runs the project scheduler until stop is closed. Projects are completed at
+// their completion time. The times are kept in the database, so projects that came due
+// while the server was down are completed as soon as it starts.
+func StartProjects(stop <-chan struct{}) {
+	go func() {
+		wait := time.Duration(0)
+		for {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-projectWake:
+			case <-stop:
+				timer.Stop()
+				return
+			}
+			timer.Stop()
+			wait = completeProjects()
+		}
+	}()
+}
+
+// wakeProjects asks the project scheduler to check when the next project is due. It never blocks.
+func wakeProjects() {
+	select {
+	case projectWake <- struct{}{}:
+	default:
+	}
+}
+
+// activeProjects selects queued projects in active game instances. Projects in a game that
+// has ended are never completed.
+func activeProjects() *gorm.DB {
+	return db.Model(&models.Project{}).
+		Joins("JOIN game_instances ON game_instances.id = projects.game_instance_id AND game_instances.deleted_at IS NULL").
+		Where("projects.status = ? AND game_instances.status = ?", models.ProjectQueued, models.InstanceActive)
+}
+
+// completeProjects completes every project that is due, tells their players and returns
+// how long the scheduler can sleep before the next one is due.
+func completeProjects() time.Duration {
+	now := time.Now()
+	var due []models.Project
+	if err := activeProjects().Where("projects.completes_at <= ?", now).Order("projects.completes_at, projects.id").Find(&due).Error; err != nil {
+		log.Printf("Failed to load due projects: %v", err)
+		return projectSweepPeriod
+	}
+	for _, project := range due {
+		// Only complete projects that were not cancelled in the meantime
+		result := db.Model(&models.Project{}).
+			Where("id = ? AND status = ?", project.ID, models.ProjectQueued).
+			Updates(map[string]interface{}{"status": models.ProjectCompleted, "completed_at": now})
+		if result.Error != nil {
+			log.Printf("Failed to complete project %d: %v", project.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		project.Status = models.ProjectCompleted
+		project.CompletedAt = &now
+		notifyProject(project)
+	}
+
+	var next []models.Project
+	if err := activeProjects().Order("projects.completes_at").Limit(1).Find(&next).Error; err != nil {
+		log.Printf("Failed to load the next project: %v", err)
+		return projectSweepPeriod
+	}
+	if len(next) == 0 {
+		return projectSweepPeriod
+	}
+	wait := time.Until(next[0].CompletesAt)
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > projectSweepPeriod {
+		wait = projectSweepPeriod
+	}
+	return wait
+}
+
+// notifyProject tells a player that one of their projects is complete.
+func notifyProject(project models.Project) {
+	payload, err := json.Marshal(project)
+	if err != nil {
+		log.Printf("Failed to encode project %d: %v", project.ID, err)
+		return
+	}
+	sendToPlayer(project.PlayerID, WSMessage{Type: MessageProjectCompleted, GameInstanceID: project.GameInstanceID, Payload: payload})
+}
+
+// queuedProjects loads the unfinished projects in one of a player's queues, in the order
+// they run.
+func queuedProjects(tx *gorm.DB, instanceID, playerID uint, kind string) ([]models.Project, error) {
+	var queue []models.Project
+	err := tx.Where("game_instance_id = ? AND player_id = ? AND kind = ? AND status = ?", instanceID, playerID, kind, models.ProjectQueued).
+		Order("id").
+		Find(&queue).Error
+	return queue, err
+}
+
+// projectSpeed returns the speed bonus a player's faction gives to projects of a kind, or
+// 1 for players without a faction.
+func projectSpeed(tx *gorm.DB, instanceID, playerID uint, kind string) (float64, error) {
+	faction, ok, err := playerFaction(tx, instanceID, playerID)
+	if err != nil || !ok {
+		return 1, err
+	}
+	if kind == projects.Research {
+		return faction.ResearchSpeed, nil
+	}
+	return faction.BuildingSpeed, nil
+}
+
+// GetProjectCatalog returns every building and piece of research with its cost and base duration.
+func GetProjectCatalog(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(projects.Catalog)
+}
+
+// StartProject spends the cost of a building or piece of research and adds it to the end
+// of the authenticated player's queue for its kind.
+func StartProject(w http.ResponseWriter, r *http.Request) {
+	var projectRequest struct {
+		GameInstanceID uint   `json:"game_instance_id"`
+		Name           string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&projectRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	blueprint, ok := projects.Lookup(projectRequest.Name)
+	if !ok {
+		http.Error(w, "Unknown project", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	cost, err := json.Marshal(blueprint.Cost)
+	if err != nil {
+		http.Error(w, "Failed to start project", http.StatusInternalServerError)
+		return
+	}
+	project := models.Project{
+		GameInstanceID: projectRequest.GameInstanceID,
+		PlayerID:       playerID,
+		Kind:           blueprint.Kind,
+		Name:           blueprint.Name,
+		Cost:           cost,
+		Status:         models.ProjectQueued,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		instance, err := lockInstance(tx, project.GameInstanceID)
+		if err != nil {
+			return err
+		}
+		if !hasPlayer(instance, playerID) {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Not a player in this game instance"}
+		}
+		if instance.Status != models.InstanceActive {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+		}
+
+		queue, err := queuedProjects(tx, instance.ID, playerID, project.Kind)
+		if err != nil {
+			return err
+		}
+		if len(queue) >= maxQueuedProjects {
+			return &InstanceError{Status: http.StatusConflict, Message: "Queue is full"}
+		}
+		speed, err := projectSpeed(tx, instance.ID, playerID, project.Kind)
+		if err != nil {
+			return err
+		}
+
+		// Start once everything ahead of it in the queue is done
+		project.StartsAt = time.Now()
+		if len(queue) > 0 && queue[len(queue)-1].CompletesAt.After(project.StartsAt) {
+			project.StartsAt = queue[len(queue)-1].CompletesAt
+		}
+		duration := projects.Duration(blueprint, speed)
+		project.Duration = int(duration / time.Second)
+		project.CompletesAt = project.StartsAt.Add(duration)
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+
+		changes := make([]resourceChange, 0, len(blueprint.Cost))
+		for resourceType, amount := range blueprint.Cost {
+			changes = append(changes, resourceChange{PlayerID: playerID, Type: resourceType, Delta: -amount, Reason: ledgerProject, ReferenceID: project.ID})
+		}
+		_, err = adjustResources(tx, instance.ID, changes)
+		return err
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to start project")
+		return
+	}
+	wakeProjects()
+	invalidateTeamBoards(project.GameInstanceID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(project)
+}
+
+// CancelProject removes an unfinished project from the authenticated player's queue. A
+// project that has not started is refunded in full, and one in progress in part. The
+// projects behind it in the queue move up.
+func CancelProject(w http.ResponseWriter, r *http.Request) {
+	projectID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var project models.Project
+	if err := db.First(&project, projectID).Error; err != nil || project.PlayerID != playerID {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the instance first, as starting a project does
+		instance, err := lockInstance(tx, project.GameInstanceID)
+		if err != nil {
+			return err
+		}
+		if instance.Status != models.InstanceActive {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&project, project.ID).Error; err != nil {
+			return err
+		}
+		if project.Status != models.ProjectQueued {
+			return &InstanceError{Status: http.StatusConflict, Message: "Project is " + project.Status}
+		}
+
+		var cost map[string]int
+		if err := json.Unmarshal(project.Cost, &cost); err != nil {
+			return err
+		}
+		now := time.Now()
+		refund := projects.Refund(cost, !project.StartsAt.After(now))
+		changes := make([]resourceChange, 0, len(refund))
+		for resourceType, amount := range refund {
+			changes = append(changes, resourceChange{PlayerID: playerID, Type: resourceType, Delta: amount, Reason: ledgerProjectRefund, ReferenceID: project.ID})
+		}
+		if _, err := adjustResources(tx, project.GameInstanceID, changes); err != nil {
+			return err
+		}
+
+		if project.Refund, err = json.Marshal(refund); err != nil {
+			return err
+		}
+		project.Status = models.ProjectCancelled
+		if err := tx.Model(&project).Updates(map[string]interface{}{"status": project.Status, "refund": project.Refund}).Error; err != nil {
+			return err
+		}
+
+		// Everything behind the cancelled project starts earlier
+		queue, err := queuedProjects(tx, project.GameInstanceID, playerID, project.Kind)
+		if err != nil {
+			return err
+		}
+		start := project.StartsAt
+		if start.Before(now) {
+			start = now
+		}
+		for _, queued := range queue {
+			if queued.ID < project.ID {
+				continue
+			}
+			completes := start.Add(time.Duration(queued.Duration) * time.Second)
+			if err := tx.Model(&queued).Updates(map[string]interface{}{"starts_at": start, "completes_at": completes}).Error; err != nil {
+				return err
+			}
+			start = completes
+		}
+		return nil
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to cancel project")
+		return
+	}
+	wakeProjects()
+	invalidateTeamBoards(project.GameInstanceID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(project)
+}
+
+// ListProjects returns the authenticated player's projects in a game instance, in the order
+// they were started.
+func ListProjects(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	query := db.Where("game_instance_id = ? AND player_id = ?", instanceID, playerID)
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	list := []models.Project{}
+	if err := query.Order("id").Find(&list).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
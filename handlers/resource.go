@@ -1,56 +1,435 @@
 package handlers
 
 import (
+	"drokkit/economy"
 	"drokkit/models"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"sort"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// UpdateResource allows updating a player's resources.
-func UpdateResource(w http.ResponseWriter, r *http.Request) {
-	var resourceUpdate struct {
-		GameInstanceID uint   `json:"game_instance_id"`
-		PlayerID       uint   `json:"player_id"`
-		Type           string `json:"type"`
-		Amount         int    `json:"amount"`
+// productionInterval is how often players produce resources in active game instances.
+const productionInterval = time.Minute
+
+// Resource ledger page sizes
+const (
+	defaultLedgerLimit = 50
+	maxLedgerLimit     = 100
+)
+
+// Reasons recorded in the resource ledger
+const (
+	ledgerStarting      = "starting"
+	ledgerProduction    = "production"
+	ledgerSpend         = "spend"
+	ledgerTransferIn    = "transfer_in"
+	ledgerTransferOut   = "transfer_out"
+	ledgerGrant         = "grant"
+	ledgerTradeIn       = "trade_in"
+	ledgerTradeOut      = "trade_out"
+	ledgerTradeFee      = "trade_fee"
+	ledgerMarketHold    = "market_hold"
+	ledgerMarketIn      = "market_in"
+	ledgerMarketRefund  = "market_refund"
+	ledgerProject       = "project"
+	ledgerProjectRefund = "project_refund"
+)
+
+// ResourceLedgerPage is a page of a player's resource ledger, newest first.
+type ResourceLedgerPage struct {
+	Entries []models.ResourceLedger `json:"entries"`
+	Next    uint                    `json:"next,omitempty"` // Pass as before to get the next page
+}
+
+// resourceRequest names an amount of a resource in a game instance.
+type resourceRequest struct {
+	GameInstanceID uint   `json:"game_instance_id"`
+	PlayerID       uint   `json:"player_id"`
+	Type           string `json:"type"`
+	Amount         int    `json:"amount"`
+}
+
+// adjustResource changes a player's balance of a resource and records the change in the
+// ledger. The balance is locked for the rest of the transaction, and a change that would
+// take it below zero is rejected.
+func adjustResource(tx *gorm.DB, instanceID, playerID uint, resourceType string, delta int, reason string, referenceID uint) (models.Resource, error) {
+	var resource models.Resource
+	if _, ok := economy.Lookup(resourceType); !ok {
+		return resource, &InstanceError{Status: http.StatusBadRequest, Message: "Unknown resource type"}
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&resourceUpdate); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(models.Resource{GameInstanceID: instanceID, PlayerID: playerID, Type: resourceType}).
+		FirstOrCreate(&resource).Error; err != nil {
+		return resource, err
+	}
+	if resource.Amount+delta < 0 {
+		return resource, &InstanceError{Status: http.StatusConflict, Message: fmt.Sprintf("Not enough %s", resourceType)}
 	}
 
-	// Find existing resource or create a new one
-	var resource models.Resource
-	result := db.Where("game_instance_id = ? AND player_id = ? AND type = ?", resourceUpdate.GameInstanceID, resourceUpdate.PlayerID, resourceUpdate.Type).First(&resource)
-
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			resource = models.Resource{
-				GameInstanceID: resourceUpdate.GameInstanceID,
-				PlayerID:       resourceUpdate.PlayerID,
-				Type:           resourceUpdate.Type,
-				Amount:         resourceUpdate.Amount,
+	resource.Amount += delta
+	resource.LastUpdated = time.Now().UTC().Format(time.RFC3339)
+	if err := tx.Save(&resource).Error; err != nil {
+		return resource, err
+	}
+
+	entry := models.ResourceLedger{
+		GameInstanceID: instanceID,
+		PlayerID:       playerID,
+		Type:           resourceType,
+		Delta:          delta,
+		Balance:        resource.Amount,
+		Reason:         reason,
+		ReferenceID:    referenceID,
+	}
+	return resource, tx.Create(&entry).Error
+}
+
+// resourceChange is a change to a player's balance of a resource.
+type resourceChange struct {
+	PlayerID    uint
+	Type        string
+	Delta       int
+	Reason      string
+	ReferenceID uint
+}
+
+// adjustResources applies several changes with adjustResource and returns the resulting
+// balances in the order the changes were given. Balances are locked in player then type
+// order so that concurrent trades between the same players cannot deadlock; changes to
+// the same balance are applied in the order given. Changes of zero are skipped.
+func adjustResources(tx *gorm.DB, instanceID uint, changes []resourceChange) ([]models.Resource, error) {
+	order := make([]int, len(changes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		first, second := changes[order[a]], changes[order[b]]
+		if first.PlayerID != second.PlayerID {
+			return first.PlayerID < second.PlayerID
+		}
+		return first.Type < second.Type
+	})
+
+	resources := make([]models.Resource, len(changes))
+	for _, i := range order {
+		change := changes[i]
+		if change.Delta == 0 {
+			continue
+		}
+		resource, err := adjustResource(tx, instanceID, change.PlayerID, change.Type, change.Delta, change.Reason, change.ReferenceID)
+		if err != nil {
+			return nil, err
+		}
+		resources[i] = resource
+	}
+	return resources, nil
+}
+
+// grantStartingResources gives every player in a game instance that has just started
+// their starting resources.
+func grantStartingResources(tx *gorm.DB, instance models.GameInstance) error {
+	for _, player := range instance.Players {
+		for _, kind := range economy.Catalog {
+			if _, err := adjustResource(tx, instance.ID, player.PlayerID, kind.Type, kind.Starting, ledgerStarting, 0); err != nil {
+				return err
 			}
-			if err := db.Create(&resource).Error; err != nil {
-				http.Error(w, "Failed to create resource", http.StatusInternalServerError)
+		}
+	}
+	return nil
+}
+
+// StartEconomy runs the background resource production worker until stop is closed.
+func StartEconomy(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(productionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				produceResources()
+			case <-stop:
 				return
 			}
-		} else {
-			http.Error(w, "Database error", http.StatusInternalServerError)
-			return
 		}
-	} else {
-		// Update existing resource
-		resource.Amount += resourceUpdate.Amount
-		resource.LastUpdated = "now" // Replace with actual timestamp
-		if err := db.Save(&resource).Error; err != nil {
-			http.Error(w, "Failed to update resource", http.StatusInternalServerError)
-			return
+	}()
+}
+
+// produceResources runs a production tick in every active game instance.
+func produceResources() {
+	var active []uint
+	if err := db.Model(&models.GameInstance{}).Where("status = ?", models.InstanceActive).Pluck("id", &active).Error; err != nil {
+		log.Printf("Failed to load active game instances: %v", err)
+		return
+	}
+	for _, instanceID := range active {
+		if err := produceInstanceResources(instanceID); err != nil {
+			log.Printf("Failed to produce resources in game instance %d: %v", instanceID, err)
+			continue
+		}
+		invalidateTeamBoards(instanceID)
+		checkVictory(instanceID)
+	}
+}
+
+// produceInstanceResources gives every player in an active game instance one tick of each
+// resource, scaled by the resource bonus of their faction.
+func produceInstanceResources(instanceID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		instance, err := lockInstance(tx, instanceID)
+		if err != nil || instance.Status != models.InstanceActive {
+			return err
+		}
+
+		var bonuses []struct {
+			PlayerID      uint
+			ResourceBonus float64
+		}
+		if err := tx.Table("faction_members AS fm").
+			Select("fm.player_id, f.resource_bonus").
+			Joins("JOIN factions AS f ON f.id = fm.faction_id AND f.deleted_at IS NULL").
+			Where("fm.game_instance_id = ? AND fm.deleted_at IS NULL", instance.ID).
+			Scan(&bonuses).Error; err != nil {
+			return err
+		}
+		bonusOf := make(map[uint]float64, len(bonuses))
+		for _, bonus := range bonuses {
+			bonusOf[bonus.PlayerID] = bonus.ResourceBonus
 		}
+
+		for _, player := range instance.Players {
+			// Players without a faction produce at the base rate
+			bonus, ok := bonusOf[player.PlayerID]
+			if !ok {
+				bonus = 1
+			}
+			for _, kind := range economy.Catalog {
+				amount := economy.Produced(kind, bonus)
+				if amount == 0 {
+					continue
+				}
+				if _, err := adjustResource(tx, instance.ID, player.PlayerID, kind.Type, amount, ledgerProduction, 0); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// activeInstanceForPlayer loads a game instance the player has joined and that is active.
+func activeInstanceForPlayer(instanceID, playerID uint) (models.GameInstance, error) {
+	instance, err := instanceForPlayer(instanceID, playerID)
+	if err == nil && instance.Status != models.InstanceActive {
+		err = &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+	}
+	return instance, err
+}
+
+// GetResourceCatalog returns every type of resource with its starting amount and base production.
+func GetResourceCatalog(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(economy.Catalog)
+}
+
+// GetResources returns the authenticated player's resources in a game instance.
+func GetResources(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+	if !isInstancePlayer(instanceID, playerID) {
+		http.Error(w, "Not a player in this game instance", http.StatusForbidden)
+		return
+	}
+
+	resources := []models.Resource{}
+	if err := db.Where("game_instance_id = ? AND player_id = ?", instanceID, playerID).Order("type").Find(&resources).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resources)
+}
+
+// GetResourceLedger returns the changes to the authenticated player's resources in a game
+// instance, newest first.
+func GetResourceLedger(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+	if !isInstancePlayer(instanceID, playerID) {
+		http.Error(w, "Not a player in this game instance", http.StatusForbidden)
+		return
+	}
+
+	query := db.Where("game_instance_id = ? AND player_id = ?", instanceID, playerID)
+	if resourceType := r.URL.Query().Get("type"); resourceType != "" {
+		query = query.Where("type = ?", resourceType)
+	}
+	if before := queryInt(r, "before", 0); before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	limit := queryInt(r, "limit", defaultLedgerLimit)
+	if limit == 0 || limit > maxLedgerLimit {
+		limit = maxLedgerLimit
+	}
+
+	page := ResourceLedgerPage{Entries: []models.ResourceLedger{}}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&page.Entries).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(page.Entries) > limit {
+		page.Entries = page.Entries[:limit]
+		page.Next = page.Entries[limit-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// SpendResource removes an amount of a resource from the authenticated player.
+func SpendResource(w http.ResponseWriter, r *http.Request) {
+	var spendRequest resourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&spendRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if spendRequest.Amount <= 0 {
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	// Players may only spend their own resources
+	playerID, ok := actingPlayer(w, r, spendRequest.PlayerID)
+	if !ok {
+		return
+	}
+	if _, err := activeInstanceForPlayer(spendRequest.GameInstanceID, playerID); err != nil {
+		writeInstanceError(w, err, "Database error")
+		return
+	}
+
+	var resource models.Resource
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		resource, err = adjustResource(tx, spendRequest.GameInstanceID, playerID, spendRequest.Type, -spendRequest.Amount, ledgerSpend, 0)
+		return err
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to spend resource")
+		return
+	}
+	invalidateTeamBoards(resource.GameInstanceID)
+	checkVictory(resource.GameInstanceID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// TransferResource moves an amount of a resource from the authenticated player to another
+// player in the same game instance.
+func TransferResource(w http.ResponseWriter, r *http.Request) {
+	var transferRequest struct {
+		resourceRequest
+		ToPlayerID uint `json:"to_player_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&transferRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if transferRequest.Amount <= 0 {
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	playerID, ok := actingPlayer(w, r, transferRequest.PlayerID)
+	if !ok {
+		return
+	}
+	if transferRequest.ToPlayerID == playerID {
+		http.Error(w, "Cannot transfer to yourself", http.StatusBadRequest)
+		return
+	}
+	instanceID := transferRequest.GameInstanceID
+	if _, err := activeInstanceForPlayer(instanceID, playerID); err != nil {
+		writeInstanceError(w, err, "Database error")
+		return
+	}
+	if !isInstancePlayer(instanceID, transferRequest.ToPlayerID) {
+		http.Error(w, "Recipient is not a player in this game instance", http.StatusBadRequest)
+		return
+	}
+
+	var resource models.Resource
+	err := db.Transaction(func(tx *gorm.DB) error {
+		from, to := playerID, transferRequest.ToPlayerID
+		resources, err := adjustResources(tx, instanceID, []resourceChange{
+			{PlayerID: from, Type: transferRequest.Type, Delta: -transferRequest.Amount, Reason: ledgerTransferOut, ReferenceID: to},
+			{PlayerID: to, Type: transferRequest.Type, Delta: transferRequest.Amount, Reason: ledgerTransferIn, ReferenceID: from},
+		})
+		if err != nil {
+			return err
+		}
+		resource = resources[0]
+		return nil
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to transfer resource")
+		return
+	}
+	invalidateTeamBoards(instanceID)
+	checkVictory(instanceID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// GrantResource lets an admin add or remove an amount of a resource for a player.
+func GrantResource(w http.ResponseWriter, r *http.Request) {
+	var grantRequest resourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&grantRequest); err != nil || grantRequest.Amount == 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !isInstancePlayer(grantRequest.GameInstanceID, grantRequest.PlayerID) {
+		http.Error(w, "Not a player in this game instance", http.StatusBadRequest)
+		return
+	}
+
+	admin, _ := AdminFromContext(r.Context())
+	var resource models.Resource
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		resource, err = adjustResource(tx, grantRequest.GameInstanceID, grantRequest.PlayerID, grantRequest.Type, grantRequest.Amount, ledgerGrant, admin.UserID)
+		return err
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to grant resource")
+		return
 	}
+	invalidateTeamBoards(resource.GameInstanceID)
+	checkVictory(resource.GameInstanceID)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resource)
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"drokkit/models"
+	"drokkit/rng"
+	"gorm.io/gorm"
+)
+
+// Draw history page sizes
+const (
+	defaultDrawLimit = 100
+	maxDrawLimit     = 1000
+)
+
+// instanceRNG draws random numbers for a game instance and records every draw. It must be
+// used inside a transaction that holds the instance lock, so draws are numbered in order.
+type instanceRNG struct {
+	tx         *gorm.DB
+	instanceID uint
+	source     *rng.Source
+}
+
+// newInstanceRNG returns the RNG of an active game instance, continuing after its last
+// recorded draw.
+func newInstanceRNG(tx *gorm.DB, instance models.GameInstance) (*instanceRNG, error) {
+	if instance.Status != models.InstanceActive || instance.RandomSeed == "" {
+		return nil, &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+	}
+
+	var drawn int64
+	if err := tx.Model(&models.RandomDraw{}).Where("game_instance_id = ?", instance.ID).Count(&drawn).Error; err != nil {
+		return nil, err
+	}
+	source, err := rng.New(instance.RandomSeed, uint64(drawn))
+	if err != nil {
+		return nil, err
+	}
+	return &instanceRNG{tx: tx, instanceID: instance.ID, source: source}, nil
+}
+
+// Intn draws a number in [0, n) and records it along with what it was drawn for.
+func (r *instanceRNG) Intn(purpose string, n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid bound %d for draw %q", n, purpose)
+	}
+
+	draw := models.RandomDraw{
+		GameInstanceID: r.instanceID,
+		Sequence:       r.source.Next(),
+		Purpose:        purpose,
+		Bound:          n,
+	}
+	draw.Value = r.source.Intn(n)
+	if err := r.tx.Create(&draw).Error; err != nil {
+		return 0, err
+	}
+	return draw.Value, nil
+}
+
+// Roll rolls a die with the given number of sides, returning 1 to sides.
+func (r *instanceRNG) Roll(purpose string, sides int) (int, error) {
+	value, err := r.Intn(purpose, sides)
+	return value + 1, err
+}
+
+// InstanceDraws is a page of the random draws made for a game instance.
+type InstanceDraws struct {
+	GameInstanceID uint                `json:"game_instance_id"`
+	Seed           string              `json:"seed,omitempty"`
+	Verified       *bool               `json:"verified,omitempty"` // Whether the draws match the seed
+	Draws          []models.RandomDraw `json:"draws"`
+	Next           uint64              `json:"next,omitempty"` // Sequence number to request the next page from
+}
+
+// GetInstanceDraws returns the random draws made for a game instance, in order. Players
+// in the instance can read them at any time, but the seed is only revealed, and the draws
+// checked against it, once the game has completed. Admins always see the seed.
+func GetInstanceDraws(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+
+	var instance models.GameInstance
+	if err := db.First(&instance, instanceID).Error; err != nil {
+		http.Error(w, "Game instance not found", http.StatusNotFound)
+		return
+	}
+
+	_, isAdmin := AdminFromContext(r.Context())
+	if !isAdmin {
+		playerID, ok := actingPlayer(w, r, 0)
+		if !ok {
+			return
+		}
+		if !isInstancePlayer(instance.ID, playerID) {
+			http.Error(w, "Not a player in this game instance", http.StatusForbidden)
+			return
+		}
+	}
+
+	limit := queryInt(r, "limit", defaultDrawLimit)
+	if limit == 0 || limit > maxDrawLimit {
+		limit = maxDrawLimit
+	}
+	from := queryInt(r, "from", 0)
+
+	page := InstanceDraws{GameInstanceID: instance.ID, Draws: []models.RandomDraw{}}
+	if err := db.Where("game_instance_id = ? AND sequence >= ?", instance.ID, from).
+		Order("sequence").
+		Limit(limit + 1).
+		Find(&page.Draws).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(page.Draws) > limit {
+		page.Next = page.Draws[limit].Sequence
+		page.Draws = page.Draws[:limit]
+	}
+
+	if (isAdmin || instance.Status == models.InstanceCompleted) && instance.RandomSeed != "" {
+		page.Seed = instance.RandomSeed
+
+		draws := make([]rng.Draw, len(page.Draws))
+		for i, draw := range page.Draws {
+			draws[i] = rng.Draw{Sequence: draw.Sequence, Bound: draw.Bound, Value: draw.Value}
+		}
+		verified := rng.Replay(instance.RandomSeed, draws) == nil
+		page.Verified = &verified
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
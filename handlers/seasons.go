@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"drokkit/leaderboard"
+	"drokkit/models"
+	"drokkit/rating"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// seasonInterval is how often seasons are checked for starting and ending
+const seasonInterval = 1 * time.Minute
+
+// seasonRewards is the experience awarded for a final season rank on each game type's board.
+var seasonRewards = []struct {
+	MaxRank    int64
+	Experience int
+}{
+	{MaxRank: 1, Experience: 100},
+	{MaxRank: 3, Experience: 50},
+	{MaxRank: 10, Experience: 25},
+}
+
+var errSeasonNotActive = errors.New("season is not active")
+
+// seasonReward returns the experience awarded for finishing a season at rank.
+func seasonReward(rank int64) int {
+	for _, reward := range seasonRewards {
+		if rank <= reward.MaxRank {
+			return reward.Experience
+		}
+	}
+	return 0
+}
+
+// StartSeasons runs the background season worker until stop is closed.
+func StartSeasons(stop <-chan struct{}) {
+	go func() {
+		advanceSeasons(time.Now())
+
+		ticker := time.NewTicker(seasonInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				advanceSeasons(time.Now())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// advanceSeasons archives active seasons that have ended, then starts the next scheduled
+// season once its start time has passed.
+func advanceSeasons(now time.Time) {
+	var ended []models.Season
+	if err := db.Where("status = ? AND ends_at <= ?", models.SeasonActive, now).Find(&ended).Error; err != nil {
+		log.Printf("Failed to load ended seasons: %v", err)
+		return
+	}
+	for _, season := range ended {
+		if _, err := archiveSeason(season.ID); err != nil && !errors.Is(err, errSeasonNotActive) {
+			log.Printf("Failed to archive season %d: %v", season.ID, err)
+		}
+	}
+
+	var active int64
+	if err := db.Model(&models.Season{}).Where("status = ?", models.SeasonActive).Count(&active).Error; err != nil || active > 0 {
+		return
+	}
+
+	var next models.Season
+	err := db.Where("status = ? AND starts_at <= ? AND ends_at > ?", models.SeasonScheduled, now, now).
+		Order("starts_at").
+		First(&next).Error
+	if err != nil {
+		return
+	}
+	if err := db.Model(&next).Update("status", models.SeasonActive).Error; err != nil {
+		log.Printf("Failed to start season %d: %v", next.ID, err)
+		return
+	}
+	PublishAlert("seasons", fmt.Sprintf("Season %q has started", next.Name))
+}
+
+// archiveSeason ends an active season. Its final standings for every game type and every
+// player's stats are archived, the top players are rewarded with experience and all
+// ratings are soft-reset for the next season.
+func archiveSeason(seasonID uint) (models.Season, error) {
+	var season models.Season
+	var gameTypes []string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&season, seasonID).Error; err != nil {
+			return err
+		}
+		if season.Status != models.SeasonActive {
+			return errSeasonNotActive
+		}
+
+		if err := tx.Model(&models.Rating{}).Distinct().Pluck("game_type", &gameTypes).Error; err != nil {
+			return err
+		}
+
+		// Final standings, ranked the same way as the live season board
+		rewards := make(map[uint]int)
+		for _, gameType := range gameTypes {
+			var entries []LeaderboardEntry
+			query := leaderboardQuery{GameType: gameType, Timeframe: seasonTimeframe, Season: &season}
+			if err := leaderboardBoard(tx, query).Order("score DESC, h.player_id").Scan(&entries).Error; err != nil {
+				return err
+			}
+
+			standings := make([]models.SeasonStanding, len(entries))
+			for i, entry := range entries {
+				rank := int64(i) + 1
+				standings[i] = models.SeasonStanding{
+					SeasonID:         season.ID,
+					GameType:         gameType,
+					PlayerID:         entry.PlayerID,
+					Rank:             rank,
+					Rating:           entry.Rating,
+					RatingChange:     entry.RatingChange,
+					GamesPlayed:      entry.GamesPlayed,
+					RewardExperience: seasonReward(rank),
+				}
+				rewards[entry.PlayerID] += standings[i].RewardExperience
+			}
+			if len(standings) > 0 {
+				if err := tx.CreateInBatches(&standings, 100).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Snapshot stats before the season rewards are added
+		var stats []models.Stats
+		if err := tx.Find(&stats).Error; err != nil {
+			return err
+		}
+		snapshots := make([]models.SeasonStats, len(stats))
+		for i, s := range stats {
+			snapshots[i] = models.SeasonStats{
+				SeasonID:    season.ID,
+				PlayerID:    s.PlayerID,
+				Wins:        s.Wins,
+				Losses:      s.Losses,
+				GamesPlayed: s.GamesPlayed,
+				Experience:  s.Experience,
+			}
+		}
+		if len(snapshots) > 0 {
+			if err := tx.CreateInBatches(&snapshots, 100).Error; err != nil {
+				return err
+			}
+		}
+
+		for playerID, experience := range rewards {
+			if experience == 0 {
+				continue
+			}
+			if err := tx.Model(&models.Stats{}).Where("player_id = ?", playerID).
+				UpdateColumn("experience", gorm.Expr("experience + ?", experience)).Error; err != nil {
+				return err
+			}
+		}
+
+		// Soft-reset every rating for the next season
+		var ratings []models.Rating
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&ratings).Error; err != nil {
+			return err
+		}
+		for _, r := range ratings {
+			if err := tx.Model(&r).Update("rating", rating.SoftReset(r.Rating)).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		season.Status = models.SeasonArchived
+		season.ArchivedAt = &now
+		return tx.Save(&season).Error
+	})
+	if err != nil {
+		return season, err
+	}
+
+	// The all-time boards are scored by rating, so they change with the reset
+	if leaderboards != nil {
+		for _, gameType := range gameTypes {
+			if err := rebuildBoard(leaderboardQuery{GameType: gameType, Timeframe: leaderboard.AllTime}); err != nil {
+				log.Printf("Failed to rebuild %s leaderboard after season %d: %v", gameType, season.ID, err)
+			}
+		}
+	}
+	PublishAlert("seasons", fmt.Sprintf("Season %q has ended", season.Name))
+
+	return season, nil
+}
+
+// resolveSeason finds the season a leaderboard request targets: the given season ID, or
+// the active season when none is given. On failure the season is nil and the status and
+// message describe the error.
+func resolveSeason(seasonID string) (*models.Season, int, string) {
+	var season models.Season
+	if seasonID == "" {
+		if err := db.Where("status = ?", models.SeasonActive).First(&season).Error; err != nil {
+			return nil, http.StatusNotFound, "No active season"
+		}
+		return &season, 0, ""
+	}
+
+	id, err := strconv.ParseUint(seasonID, 10, 32)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid season_id"
+	}
+	if err := db.First(&season, id).Error; err != nil {
+		return nil, http.StatusNotFound, "Season not found"
+	}
+	if season.Status == models.SeasonScheduled {
+		return nil, http.StatusBadRequest, "Season has not started"
+	}
+	return &season, 0, ""
+}
+
+// CreateSeason schedules a new season.
+func CreateSeason(w http.ResponseWriter, r *http.Request) {
+	var seasonRequest struct {
+		Name     string    `json:"name"`
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&seasonRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if seasonRequest.Name == "" {
+		http.Error(w, "Season name is required", http.StatusBadRequest)
+		return
+	}
+	if !seasonRequest.EndsAt.After(seasonRequest.StartsAt) || !seasonRequest.EndsAt.After(time.Now()) {
+		http.Error(w, "Season must end after it starts and in the future", http.StatusBadRequest)
+		return
+	}
+
+	// Seasons may not overlap
+	var overlapping int64
+	if err := db.Model(&models.Season{}).
+		Where("starts_at < ? AND ends_at > ?", seasonRequest.EndsAt, seasonRequest.StartsAt).
+		Count(&overlapping).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if overlapping > 0 {
+		http.Error(w, "Season overlaps an existing season", http.StatusConflict)
+		return
+	}
+
+	season := models.Season{
+		Name:     seasonRequest.Name,
+		StartsAt: seasonRequest.StartsAt,
+		EndsAt:   seasonRequest.EndsAt,
+		Status:   models.SeasonScheduled,
+	}
+	if err := db.Create(&season).Error; err != nil {
+		http.Error(w, "Failed to create season", http.StatusInternalServerError)
+		return
+	}
+
+	// A season that has already started becomes active straight away
+	advanceSeasons(time.Now())
+	db.First(&season, season.ID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(season)
+}
+
+// EndSeason ends the active season early and archives it.
+func EndSeason(w http.ResponseWriter, r *http.Request) {
+	seasonID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid season ID", http.StatusBadRequest)
+		return
+	}
+
+	result := db.Model(&models.Season{}).
+		Where("id = ? AND status = ?", seasonID, models.SeasonActive).
+		Update("ends_at", time.Now())
+	if result.Error != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Season is not active", http.StatusConflict)
+		return
+	}
+
+	season, err := archiveSeason(seasonID)
+	if err != nil {
+		if errors.Is(err, errSeasonNotActive) {
+			http.Error(w, "Season is not active", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to end season", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(season)
+}
+
+// ListSeasons returns every season, most recent first.
+func ListSeasons(w http.ResponseWriter, r *http.Request) {
+	var seasons []models.Season
+	if err := db.Order("starts_at DESC").Find(&seasons).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(seasons)
+}
+
+// GetSeason returns a single season.
+func GetSeason(w http.ResponseWriter, r *http.Request) {
+	seasonID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid season ID", http.StatusBadRequest)
+		return
+	}
+
+	var season models.Season
+	if err := db.First(&season, seasonID).Error; err != nil {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(season)
+}
+
+// GetSeasonStats returns a page of the player stats archived when a season ended,
+// ordered by experience.
+func GetSeasonStats(w http.ResponseWriter, r *http.Request) {
+	seasonID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid season ID", http.StatusBadRequest)
+		return
+	}
+
+	var season models.Season
+	if err := db.First(&season, seasonID).Error; err != nil {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	}
+	if season.Status != models.SeasonArchived {
+		http.Error(w, "Season has not ended", http.StatusConflict)
+		return
+	}
+
+	cursor, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	var offset int64
+	if cursor != nil {
+		offset = cursor.Rank
+	}
+	limit := queryInt(r, "limit", defaultLeaderboardLimit)
+	if limit == 0 || limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
+	}
+
+	stats := []models.SeasonStats{}
+	if err := db.Where("season_id = ?", season.ID).
+		Order("experience DESC, player_id").
+		Offset(int(offset)).Limit(limit).
+		Find(&stats).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{"stats": stats}
+	if len(stats) == limit {
+		last := stats[len(stats)-1]
+		response["next_cursor"] = encodeCursor(leaderboardCursor{Rank: offset + int64(limit), Score: last.Experience, PlayerID: last.PlayerID})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"drokkit/models"
+	"drokkit/rating"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Experience awarded to each player when a match or game instance ends
+const (
+	experienceWin  = 30
+	experienceDraw = 15
+	experienceLoss = 5
+)
+
+// Game results, from a player's point of view
+const (
+	resultWin = iota
+	resultDraw
+	resultLoss
+)
+
+// recordMatchStats updates both players' stats once a match has ended.
+// It must be called inside the transaction that ends the match.
+func recordMatchStats(tx *gorm.DB, match models.Match) error {
+	for _, playerID := range []uint{match.PlayerOne, match.PlayerTwo} {
+		result := resultLoss
+		switch match.WinnerID {
+		case 0:
+			result = resultDraw
+		case playerID:
+			result = resultWin
+		}
+		if err := recordPlayerResult(tx, playerID, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordPlayerResult adds a finished game to a player's stats.
+func recordPlayerResult(tx *gorm.DB, playerID uint, result int) error {
+	var stats models.Stats
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(models.Stats{PlayerID: playerID}).FirstOrCreate(&stats).Error; err != nil {
+		return err
+	}
+
+	stats.GamesPlayed++
+	switch result {
+	case resultWin:
+		stats.Wins++
+		stats.Experience += experienceWin
+	case resultDraw:
+		stats.Experience += experienceDraw
+	default:
+		stats.Losses++
+		stats.Experience += experienceLoss
+	}
+	return tx.Save(&stats).Error
+}
+
+// lockRating loads a player's rating for a game type for update, creating it at the initial rating if needed.
+func lockRating(tx *gorm.DB, playerID uint, gameType string) (models.Rating, error) {
+	var r models.Rating
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(models.Rating{PlayerID: playerID, GameType: gameType}).
+		Attrs(models.Rating{Rating: rating.Initial}).
+		FirstOrCreate(&r).Error
+	return r, err
+}
+
+// recordMatchRatings applies the Elo update for a finished match and writes a history row for
+// each player. It must be called inside the transaction that ends the match.
+func recordMatchRatings(tx *gorm.DB, match models.Match) error {
+	one, err := lockRating(tx, match.PlayerOne, match.GameType)
+	if err != nil {
+		return err
+	}
+	two, err := lockRating(tx, match.PlayerTwo, match.GameType)
+	if err != nil {
+		return err
+	}
+
+	score := rating.Draw
+	switch match.WinnerID {
+	case match.PlayerOne:
+		score = rating.Win
+	case match.PlayerTwo:
+		score = rating.Loss
+	}
+	delta := rating.Default.Delta(one.Rating, two.Rating, score)
+
+	for _, change := range []struct {
+		rating *models.Rating
+		delta  int
+	}{{&one, delta}, {&two, -delta}} {
+		history := models.RatingHistory{
+			PlayerID:     change.rating.PlayerID,
+			GameType:     match.GameType,
+			MatchID:      match.ID,
+			RatingBefore: change.rating.Rating,
+			RatingAfter:  change.rating.Rating + change.delta,
+			Delta:        change.delta,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+
+		change.rating.Rating += change.delta
+		change.rating.GamesPlayed++
+		if err := tx.Save(change.rating).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
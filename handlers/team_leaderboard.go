@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"drokkit/leaderboard"
+	"drokkit/models"
+	"gorm.io/gorm"
+)
+
+// TeamLeaderboardEntry is a faction's or alliance's position on a team leaderboard.
+type TeamLeaderboardEntry struct {
+	leaderboard.TeamStanding
+	Type           string `json:"type"`
+	Name           string `json:"name"` // Alliance name, or faction type for factions
+	GameInstanceID uint   `json:"game_instance_id"`
+}
+
+// TeamLeaderboardPage is one page of a team leaderboard. NextCursor is empty on the last page.
+type TeamLeaderboardPage struct {
+	Entries    []TeamLeaderboardEntry `json:"entries"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// teamTotal is one row of a per-team aggregate query.
+type teamTotal struct {
+	TeamID uint
+	Total  int
+}
+
+// GetTeamLeaderboard returns a page of the faction or alliance leaderboard, optionally
+// limited to a single game instance. The season timeframe ranks teams in the game
+// instances that started during a season.
+func GetTeamLeaderboard(w http.ResponseWriter, r *http.Request, kind string) {
+	var season *models.Season
+	switch timeframe := r.URL.Query().Get("timeframe"); timeframe {
+	case "", leaderboard.AllTime:
+	case seasonTimeframe:
+		var status int
+		var message string
+		if season, status, message = resolveSeason(r.URL.Query().Get("season_id")); season == nil {
+			http.Error(w, message, status)
+			return
+		}
+	default:
+		http.Error(w, "Team leaderboards only support the all-time and season timeframes", http.StatusBadRequest)
+		return
+	}
+
+	var instanceID uint
+	if value := r.URL.Query().Get("game_instance_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || id == 0 {
+			http.Error(w, "Invalid game_instance_id", http.StatusBadRequest)
+			return
+		}
+		instanceID = uint(id)
+	}
+
+	metric := r.URL.Query().Get("sort")
+	if metric == "" {
+		metric = leaderboard.ZonesHeld
+	}
+	if !leaderboard.ValidMetric(metric) {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	var offset int64
+	if cursor != nil {
+		offset = cursor.Rank
+	}
+	limit := queryInt(r, "limit", defaultLeaderboardLimit)
+	if limit == 0 || limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
+	}
+
+	standings, err := teamStandingsPage(kind, instanceID, season, metric, offset, int64(limit))
+	if err != nil {
+		http.Error(w, "Failed to load leaderboard", http.StatusInternalServerError)
+		return
+	}
+	entries, err := describeTeams(kind, standings)
+	if err != nil {
+		http.Error(w, "Failed to load leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	page := TeamLeaderboardPage{Entries: entries}
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		page.NextCursor = encodeCursor(leaderboardCursor{Rank: last.Rank, Score: last.Score(metric), PlayerID: last.TeamID})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// teamStandingsPage loads a page of a team board from the Redis cache, computing and
+// caching the board first if needed. Season boards, and every board without Redis, are
+// computed on every read.
+func teamStandingsPage(kind string, instanceID uint, season *models.Season, metric string, offset, limit int64) ([]leaderboard.TeamStanding, error) {
+	if leaderboards != nil && season == nil {
+		exists, err := leaderboards.TeamsExist(kind, instanceID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			standings, err := computeTeamStandings(kind, instanceID, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := leaderboards.RebuildTeams(kind, instanceID, standings); err != nil {
+				return nil, err
+			}
+		}
+		return leaderboards.TeamPage(kind, instanceID, metric, offset, limit)
+	}
+
+	standings, err := computeTeamStandings(kind, instanceID, season)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Score(metric) != standings[j].Score(metric) {
+			return standings[i].Score(metric) > standings[j].Score(metric)
+		}
+		return standings[i].TeamID < standings[j].TeamID
+	})
+	for i := range standings {
+		standings[i].Rank = int64(i) + 1
+	}
+
+	if offset >= int64(len(standings)) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > int64(len(standings)) {
+		end = int64(len(standings))
+	}
+	return standings[offset:end], nil
+}
+
+// computeTeamStandings totals zones held, combat wins and resources for every faction, or
+// every alliance, in the game instance. An instance ID of zero covers all instances, and a
+// season limits them to the instances that started during the season. Combat logs record
+// the attacking and defending factions, and a faction's resources are everything its
+// members hold in the faction's instance. An alliance's totals are the sum of its member
+// factions'.
+func computeTeamStandings(kind string, instanceID uint, season *models.Season) ([]leaderboard.TeamStanding, error) {
+	var factions []models.Faction
+	if err := teamInstances(db.Select("id"), "game_instance_id", instanceID, season).Find(&factions).Error; err != nil {
+		return nil, err
+	}
+
+	byFaction := make(map[uint]*leaderboard.TeamStanding, len(factions))
+	for _, faction := range factions {
+		byFaction[faction.ID] = &leaderboard.TeamStanding{TeamID: faction.ID}
+	}
+
+	add := func(metric string, totals []teamTotal) {
+		for _, total := range totals {
+			if standing, ok := byFaction[total.TeamID]; ok {
+				standing.SetScore(metric, standing.Score(metric)+total.Total)
+			}
+		}
+	}
+
+	var zones, attackerWins, defenderWins, resources []teamTotal
+	if err := teamInstances(db.Model(&models.Zone{}), "game_instance_id", instanceID, season).
+		Select("controlled_by_faction_id AS team_id, COUNT(*) AS total").
+		Where("controlled_by_faction_id <> 0").
+		Group("controlled_by_faction_id").
+		Scan(&zones).Error; err != nil {
+		return nil, err
+	}
+	if err := teamInstances(db.Model(&models.CombatLog{}), "game_instance_id", instanceID, season).
+		Select("attacker_id AS team_id, COUNT(*) AS total").
+		Where("outcome = ?", "Attacker Wins").
+		Group("attacker_id").
+		Scan(&attackerWins).Error; err != nil {
+		return nil, err
+	}
+	if err := teamInstances(db.Model(&models.CombatLog{}), "game_instance_id", instanceID, season).
+		Select("defender_id AS team_id, COUNT(*) AS total").
+		Where("outcome = ?", "Defender Wins").
+		Group("defender_id").
+		Scan(&defenderWins).Error; err != nil {
+		return nil, err
+	}
+	if err := teamInstances(db.Table("resources AS r"), "r.game_instance_id", instanceID, season).
+		Select("fm.faction_id AS team_id, SUM(r.amount) AS total").
+		Joins("JOIN faction_members AS fm ON fm.player_id = r.player_id AND fm.deleted_at IS NULL").
+		Joins("JOIN factions AS f ON f.id = fm.faction_id AND f.game_instance_id = r.game_instance_id").
+		Where("r.deleted_at IS NULL").
+		Group("fm.faction_id").
+		Scan(&resources).Error; err != nil {
+		return nil, err
+	}
+	add(leaderboard.ZonesHeld, zones)
+	add(leaderboard.CombatWins, attackerWins)
+	add(leaderboard.CombatWins, defenderWins)
+	add(leaderboard.Resources, resources)
+
+	if kind == leaderboard.Faction {
+		standings := make([]leaderboard.TeamStanding, 0, len(byFaction))
+		for _, standing := range byFaction {
+			standings = append(standings, *standing)
+		}
+		return standings, nil
+	}
+
+	var alliances []models.Alliance
+	if err := teamInstances(db.Preload("AllianceMembers"), "game_instance_id", instanceID, season).Find(&alliances).Error; err != nil {
+		return nil, err
+	}
+
+	standings := make([]leaderboard.TeamStanding, 0, len(alliances))
+	for _, alliance := range alliances {
+		standing := leaderboard.TeamStanding{TeamID: alliance.ID}
+		for _, member := range alliance.AllianceMembers {
+			if faction, ok := byFaction[member.FactionID]; ok {
+				standing.ZonesHeld += faction.ZonesHeld
+				standing.CombatWins += faction.CombatWins
+				standing.Resources += faction.Resources
+			}
+		}
+		standings = append(standings, standing)
+	}
+	return standings, nil
+}
+
+// teamInstances limits a query to a game instance, or to the instances that started
+// during a season, by the game instance ID in column.
+func teamInstances(query *gorm.DB, column string, instanceID uint, season *models.Season) *gorm.DB {
+	if instanceID != 0 {
+		query = query.Where(column+" = ?", instanceID)
+	}
+	if season != nil {
+		started := db.Model(&models.GameInstance{}).Select("id").
+			Where("started_at >= ? AND started_at < ?", season.StartsAt, season.EndsAt)
+		query = query.Where(column+" IN (?)", started)
+	}
+	return query
+}
+
+// describeTeams adds the name and game instance of each team on a page.
+func describeTeams(kind string, standings []leaderboard.TeamStanding) ([]TeamLeaderboardEntry, error) {
+	ids := make([]uint, len(standings))
+	for i, standing := range standings {
+		ids[i] = standing.TeamID
+	}
+
+	type team struct {
+		Name           string
+		GameInstanceID uint
+	}
+	teams := make(map[uint]team, len(ids))
+	if kind == leaderboard.Faction {
+		var factions []models.Faction
+		if err := db.Where("id IN ?", ids).Find(&factions).Error; err != nil {
+			return nil, err
+		}
+		for _, faction := range factions {
+			teams[faction.ID] = team{Name: faction.FactionType, GameInstanceID: faction.GameInstanceID}
+		}
+	} else {
+		var alliances []models.Alliance
+		if err := db.Where("id IN ?", ids).Find(&alliances).Error; err != nil {
+			return nil, err
+		}
+		for _, alliance := range alliances {
+			teams[alliance.ID] = team{Name: alliance.Name, GameInstanceID: alliance.GameInstanceID}
+		}
+	}
+
+	entries := make([]TeamLeaderboardEntry, len(standings))
+	for i, standing := range standings {
+		entries[i] = TeamLeaderboardEntry{
+			TeamStanding:   standing,
+			Type:           kind,
+			Name:           teams[standing.TeamID].Name,
+			GameInstanceID: teams[standing.TeamID].GameInstanceID,
+		}
+	}
+	return entries, nil
+}
+
+// invalidateTeamBoards drops the cached team boards for a game instance after its
+// factions, alliances, zones, combat logs or resources change.
+func invalidateTeamBoards(instanceID uint) {
+	if leaderboards == nil {
+		return
+	}
+	if err := leaderboards.InvalidateTeams(instanceID); err != nil {
+		log.Printf("Failed to invalidate team leaderboards for game instance %d: %v", instanceID, err)
+	}
+}
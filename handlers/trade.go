@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"drokkit/economy"
+	"drokkit/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Trade offer settings
+const (
+	defaultTradeExpiry  = 5 * time.Minute
+	maxTradeExpiry      = time.Hour
+	tradeExpiryInterval = 30 * time.Second // How often pending offers are checked for expiry
+	defaultTradeLimit   = 50
+	maxTradeLimit       = 100
+)
+
+// TradeOfferPage is a page of trade offers, newest first.
+type TradeOfferPage struct {
+	Offers []models.TradeOffer `json:"offers"`
+	Next   uint                `json:"next,omitempty"` // Pass as before to get the next page
+}
+
+// tradeTerms are the resources swapped by a trade offer, as seen by its proposer.
+type tradeTerms struct {
+	OfferType     string `json:"offer_type"`
+	OfferAmount   int    `json:"offer_amount"`
+	RequestType   string `json:"request_type"`
+	RequestAmount int    `json:"request_amount"`
+	ExpiresIn     int    `json:"expires_in"` // Seconds until the offer expires, optional
+}
+
+// validate checks the terms and returns how long the offer stays open.
+func (terms tradeTerms) validate() (time.Duration, error) {
+	if _, ok := economy.Lookup(terms.OfferType); !ok {
+		return 0, &InstanceError{Status: http.StatusBadRequest, Message: "Unknown resource type"}
+	}
+	if _, ok := economy.Lookup(terms.RequestType); !ok {
+		return 0, &InstanceError{Status: http.StatusBadRequest, Message: "Unknown resource type"}
+	}
+	if terms.OfferType == terms.RequestType {
+		return 0, &InstanceError{Status: http.StatusBadRequest, Message: "offer_type and request_type must differ"}
+	}
+	if terms.OfferAmount <= 0 || terms.RequestAmount <= 0 {
+		return 0, &InstanceError{Status: http.StatusBadRequest, Message: "offer_amount and request_amount must be positive"}
+	}
+
+	expiry := defaultTradeExpiry
+	if terms.ExpiresIn < 0 {
+		return 0, &InstanceError{Status: http.StatusBadRequest, Message: "expires_in must not be negative"}
+	}
+	if terms.ExpiresIn > 0 {
+		expiry = time.Duration(terms.ExpiresIn) * time.Second
+	}
+	if expiry > maxTradeExpiry {
+		expiry = maxTradeExpiry
+	}
+	return expiry, nil
+}
+
+// tradeRate returns the trade rate of a player's faction in a game instance, or 1 for
+// players without a faction.
+func tradeRate(tx *gorm.DB, instanceID, playerID uint) (float64, error) {
+	faction, ok, err := playerFaction(tx, instanceID, playerID)
+	if err != nil || !ok {
+		return 1, err
+	}
+	return faction.TradeRate, nil
+}
+
+// proposeTrade records a pending offer from a player who must currently hold what they offer.
+func proposeTrade(tx *gorm.DB, instanceID, fromID, toID uint, terms tradeTerms, counterOfID uint) (models.TradeOffer, error) {
+	offer := models.TradeOffer{
+		GameInstanceID: instanceID,
+		FromPlayerID:   fromID,
+		ToPlayerID:     toID,
+		OfferType:      terms.OfferType,
+		OfferAmount:    terms.OfferAmount,
+		RequestType:    terms.RequestType,
+		RequestAmount:  terms.RequestAmount,
+		Status:         models.TradePending,
+		CounterOfID:    counterOfID,
+	}
+	expiry, err := terms.validate()
+	if err != nil {
+		return offer, err
+	}
+	offer.ExpiresAt = time.Now().Add(expiry)
+
+	var held models.Resource
+	err = tx.Where("game_instance_id = ? AND player_id = ? AND type = ?", instanceID, fromID, terms.OfferType).First(&held).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return offer, err
+	}
+	if held.Amount < terms.OfferAmount {
+		return offer, &InstanceError{Status: http.StatusConflict, Message: "Not enough " + terms.OfferType}
+	}
+	return offer, tx.Create(&offer).Error
+}
+
+// lockTradeOffer loads a trade offer for update, after locking its game instance.
+func lockTradeOffer(tx *gorm.DB, offerID uint) (models.TradeOffer, models.GameInstance, error) {
+	var offer models.TradeOffer
+	if err := tx.First(&offer, offerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return offer, models.GameInstance{}, &InstanceError{Status: http.StatusNotFound, Message: "Trade offer not found"}
+		}
+		return offer, models.GameInstance{}, err
+	}
+	instance, err := lockInstance(tx, offer.GameInstanceID)
+	if err != nil {
+		return offer, instance, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&offer, offer.ID).Error; err != nil {
+		return offer, instance, err
+	}
+	return offer, instance, nil
+}
+
+// openTradeOffer checks that an offer can still be answered.
+func openTradeOffer(offer models.TradeOffer) error {
+	if offer.Status != models.TradePending {
+		return &InstanceError{Status: http.StatusConflict, Message: "Trade offer is " + offer.Status}
+	}
+	if time.Now().After(offer.ExpiresAt) {
+		return &InstanceError{Status: http.StatusConflict, Message: "Trade offer has expired"}
+	}
+	return nil
+}
+
+// resolveTradeOffer closes an offer with the given status.
+func resolveTradeOffer(tx *gorm.DB, offer *models.TradeOffer, status string) error {
+	now := time.Now()
+	offer.Status = status
+	offer.ResolvedAt = &now
+	return tx.Model(offer).Updates(map[string]interface{}{"status": offer.Status, "resolved_at": offer.ResolvedAt}).Error
+}
+
+// settleTrade swaps the resources of an accepted offer. Each player receives the other's
+// resource less a fee set by their faction's trade rate.
+func settleTrade(tx *gorm.DB, offer models.TradeOffer) error {
+	proposerRate, err := tradeRate(tx, offer.GameInstanceID, offer.FromPlayerID)
+	if err != nil {
+		return err
+	}
+	recipientRate, err := tradeRate(tx, offer.GameInstanceID, offer.ToPlayerID)
+	if err != nil {
+		return err
+	}
+
+	_, err = adjustResources(tx, offer.GameInstanceID, []resourceChange{
+		{PlayerID: offer.FromPlayerID, Type: offer.OfferType, Delta: -offer.OfferAmount, Reason: ledgerTradeOut, ReferenceID: offer.ID},
+		{PlayerID: offer.FromPlayerID, Type: offer.RequestType, Delta: offer.RequestAmount, Reason: ledgerTradeIn, ReferenceID: offer.ID},
+		{PlayerID: offer.FromPlayerID, Type: offer.RequestType, Delta: -economy.TradeFee(offer.RequestAmount, proposerRate), Reason: ledgerTradeFee, ReferenceID: offer.ID},
+		{PlayerID: offer.ToPlayerID, Type: offer.RequestType, Delta: -offer.RequestAmount, Reason: ledgerTradeOut, ReferenceID: offer.ID},
+		{PlayerID: offer.ToPlayerID, Type: offer.OfferType, Delta: offer.OfferAmount, Reason: ledgerTradeIn, ReferenceID: offer.ID},
+		{PlayerID: offer.ToPlayerID, Type: offer.OfferType, Delta: -economy.TradeFee(offer.OfferAmount, recipientRate), Reason: ledgerTradeFee, ReferenceID: offer.ID},
+	})
+	return err
+}
+
+// notifyTrade tells both players of a trade offer that it changed.
+func notifyTrade(offer models.TradeOffer) {
+	payload, err := json.Marshal(offer)
+	if err != nil {
+		log.Printf("Failed to encode trade offer %d: %v", offer.ID, err)
+		return
+	}
+	msg := WSMessage{Type: MessageTradeUpdated, GameInstanceID: offer.GameInstanceID, Payload: payload}
+	sendToPlayer(offer.FromPlayerID, msg)
+	sendToPlayer(offer.ToPlayerID, msg)
+}
+
+// StartTrading runs the background worker that expires trade offers until stop is closed.
+func StartTrading(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(tradeExpiryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				expireTradeOffers()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// expireTradeOffers closes every pending offer past its expiry and tells its players.
+func expireTradeOffers() {
+	var expired []models.TradeOffer
+	if err := db.Where("status = ? AND expires_at < ?", models.TradePending, time.Now()).Find(&expired).Error; err != nil {
+		log.Printf("Failed to load expired trade offers: %v", err)
+		return
+	}
+	for _, offer := range expired {
+		now := time.Now()
+		// Only expire offers nobody answered in the meantime
+		result := db.Model(&models.TradeOffer{}).
+			Where("id = ? AND status = ?", offer.ID, models.TradePending).
+			Updates(map[string]interface{}{"status": models.TradeExpired, "resolved_at": now})
+		if result.Error != nil {
+			log.Printf("Failed to expire trade offer %d: %v", offer.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		offer.Status = models.TradeExpired
+		offer.ResolvedAt = &now
+		notifyTrade(offer)
+	}
+}
+
+// ProposeTrade lets a player offer another player in the same game instance a swap of resources.
+func ProposeTrade(w http.ResponseWriter, r *http.Request) {
+	var tradeRequest struct {
+		tradeTerms
+		GameInstanceID uint `json:"game_instance_id"`
+		ToPlayerID     uint `json:"to_player_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&tradeRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+	if tradeRequest.ToPlayerID == playerID {
+		http.Error(w, "Cannot trade with yourself", http.StatusBadRequest)
+		return
+	}
+	instanceID := tradeRequest.GameInstanceID
+	if _, err := activeInstanceForPlayer(instanceID, playerID); err != nil {
+		writeInstanceError(w, err, "Database error")
+		return
+	}
+	if !isInstancePlayer(instanceID, tradeRequest.ToPlayerID) {
+		http.Error(w, "Recipient is not a player in this game instance", http.StatusBadRequest)
+		return
+	}
+
+	var offer models.TradeOffer
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		offer, err = proposeTrade(tx, instanceID, playerID, tradeRequest.ToPlayerID, tradeRequest.tradeTerms, 0)
+		return err
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to propose trade")
+		return
+	}
+	notifyTrade(offer)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(offer)
+}
+
+// CounterTrade lets the recipient of a pending offer reject it with an offer of their own.
+func CounterTrade(w http.ResponseWriter, r *http.Request) {
+	offerID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid trade offer ID", http.StatusBadRequest)
+		return
+	}
+	var terms tradeTerms
+	if err := json.NewDecoder(r.Body).Decode(&terms); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var original, counter models.TradeOffer
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var instance models.GameInstance
+		var err error
+		original, instance, err = lockTradeOffer(tx, offerID)
+		if err != nil {
+			return err
+		}
+		if original.ToPlayerID != playerID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the recipient can counter a trade offer"}
+		}
+		if err := openTradeOffer(original); err != nil {
+			return err
+		}
+		if instance.Status != models.InstanceActive {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+		}
+		if err := resolveTradeOffer(tx, &original, models.TradeCountered); err != nil {
+			return err
+		}
+		counter, err = proposeTrade(tx, instance.ID, playerID, original.FromPlayerID, terms, original.ID)
+		return err
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to counter trade offer")
+		return
+	}
+	notifyTrade(original)
+	notifyTrade(counter)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(counter)
+}
+
+// AcceptTrade lets the recipient of a pending offer accept it, swapping the resources.
+func AcceptTrade(w http.ResponseWriter, r *http.Request) {
+	offerID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid trade offer ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var offer models.TradeOffer
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var instance models.GameInstance
+		var err error
+		offer, instance, err = lockTradeOffer(tx, offerID)
+		if err != nil {
+			return err
+		}
+		if offer.ToPlayerID != playerID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the recipient can accept a trade offer"}
+		}
+		if err := openTradeOffer(offer); err != nil {
+			return err
+		}
+		if instance.Status != models.InstanceActive {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+		}
+		if err := settleTrade(tx, offer); err != nil {
+			return err
+		}
+		return resolveTradeOffer(tx, &offer, models.TradeAccepted)
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to accept trade offer")
+		return
+	}
+	notifyTrade(offer)
+	invalidateTeamBoards(offer.GameInstanceID)
+	checkVictory(offer.GameInstanceID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(offer)
+}
+
+// DeclineTrade lets the recipient of a pending offer turn it down.
+func DeclineTrade(w http.ResponseWriter, r *http.Request) {
+	closeTrade(w, r, models.TradeDeclined)
+}
+
+// CancelTrade lets the proposer of a pending offer withdraw it.
+func CancelTrade(w http.ResponseWriter, r *http.Request) {
+	closeTrade(w, r, models.TradeCancelled)
+}
+
+// closeTrade closes a pending offer without a swap. Offers are declined by their recipient
+// and cancelled by their proposer.
+func closeTrade(w http.ResponseWriter, r *http.Request, status string) {
+	offerID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid trade offer ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var offer models.TradeOffer
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		offer, _, err = lockTradeOffer(tx, offerID)
+		if err != nil {
+			return err
+		}
+		if status == models.TradeDeclined && offer.ToPlayerID != playerID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the recipient can decline a trade offer"}
+		}
+		if status == models.TradeCancelled && offer.FromPlayerID != playerID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the proposer can cancel a trade offer"}
+		}
+		if offer.Status != models.TradePending {
+			return &InstanceError{Status: http.StatusConflict, Message: "Trade offer is " + offer.Status}
+		}
+		return resolveTradeOffer(tx, &offer, status)
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to update trade offer")
+		return
+	}
+	notifyTrade(offer)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(offer)
+}
+
+// GetTrade returns a trade offer to one of its players.
+func GetTrade(w http.ResponseWriter, r *http.Request) {
+	offerID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid trade offer ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var offer models.TradeOffer
+	if err := db.First(&offer, offerID).Error; err != nil || (offer.FromPlayerID != playerID && offer.ToPlayerID != playerID) {
+		http.Error(w, "Trade offer not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(offer)
+}
+
+// ListTrades returns the trade offers the authenticated player made or received in a game
+// instance, newest first.
+func ListTrades(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	query := db.Where("game_instance_id = ? AND (from_player_id = ? OR to_player_id = ?)", instanceID, playerID, playerID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if before := queryInt(r, "before", 0); before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	limit := queryInt(r, "limit", defaultTradeLimit)
+	if limit == 0 || limit > maxTradeLimit {
+		limit = maxTradeLimit
+	}
+
+	page := TradeOfferPage{Offers: []models.TradeOffer{}}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&page.Offers).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(page.Offers) > limit {
+		page.Offers = page.Offers[:limit]
+		page.Next = page.Offers[limit-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
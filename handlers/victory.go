@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"drokkit/models"
+	"drokkit/victory"
+	"gorm.io/gorm"
+)
+
+// Victory evaluator settings
+const (
+	victoryQueueSize     = 256
+	victorySweepInterval = time.Minute // How often every active game instance is checked
+)
+
+// defaultVictoryCondition is given to game instances started without any victory condition.
+var defaultVictoryCondition = models.VictoryCondition{Type: victory.Domination, Details: `{"zone_share":0.6}`}
+
+// victoryChecks queues game instances whose state changed for the victory evaluator.
+var victoryChecks = make(chan uint, victoryQueueSize)
+
+// GameOver is sent to a game instance's room when a victory condition ends the game.
+type GameOver struct {
+	GameInstanceID   uint                    `json:"game_instance_id"`
+	WinnerFactionID  uint                    `json:"winner_faction_id"`
+	Winners          []uint                  `json:"winners"` // Players in the winning faction
+	VictoryCondition models.VictoryCondition `json:"victory_condition"`
+}
+
+// StartVictoryEvaluator runs the background victory evaluator until stop is closed. Game
+// instances are checked as soon as their state changes, and every active instance is
+// checked periodically in case a change was missed.
+func StartVictoryEvaluator(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(victorySweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case instanceID := <-victoryChecks:
+				evaluateVictory(instanceID)
+			case <-ticker.C:
+				var active []uint
+				if err := db.Model(&models.GameInstance{}).Where("status = ?", models.InstanceActive).Pluck("id", &active).Error; err != nil {
+					log.Printf("Failed to load active game instances: %v", err)
+					continue
+				}
+				for _, instanceID := range active {
+					evaluateVictory(instanceID)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// checkVictory asks the victory evaluator to check a game instance. It never blocks; if
+// the queue is full the periodic check picks the instance up.
+func checkVictory(instanceID uint) {
+	select {
+	case victoryChecks <- instanceID:
+	default:
+	}
+}
+
+// victoryStandings totals each faction's zones, resources and kills in a game instance,
+// along with the number of zones on its map.
+func victoryStandings(tx *gorm.DB, instanceID uint) ([]victory.Standing, int, error) {
+	var factions []models.Faction
+	if err := tx.Select("id").Where("game_instance_id = ?", instanceID).Order("id").Find(&factions).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var totalZones int64
+	if err := tx.Model(&models.Zone{}).Where("game_instance_id = ?", instanceID).Count(&totalZones).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var zones, resources, attackerKills, defenderKills []teamTotal
+	if err := tx.Model(&models.Zone{}).
+		Select("controlled_by_faction_id AS team_id, COUNT(*) AS total").
+		Where("game_instance_id = ? AND controlled_by_faction_id <> 0", instanceID).
+		Group("controlled_by_faction_id").
+		Scan(&zones).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Table("resources AS r").
+		Select("fm.faction_id AS team_id, SUM(r.amount) AS total").
+		Joins("JOIN faction_members AS fm ON fm.player_id = r.player_id AND fm.deleted_at IS NULL").
+		Joins("JOIN factions AS f ON f.id = fm.faction_id AND f.game_instance_id = r.game_instance_id").
+		Where("r.game_instance_id = ? AND r.deleted_at IS NULL", instanceID).
+		Group("fm.faction_id").
+		Scan(&resources).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Model(&models.CombatLog{}).
+		Select("attacker_id AS team_id, SUM(units_lost_defender) AS total").
+		Where("game_instance_id = ?", instanceID).
+		Group("attacker_id").
+		Scan(&attackerKills).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Model(&models.CombatLog{}).
+		Select("defender_id AS team_id, SUM(units_lost_attacker) AS total").
+		Where("game_instance_id = ? AND defender_id <> 0", instanceID).
+		Group("defender_id").
+		Scan(&defenderKills).Error; err != nil {
+		return nil, 0, err
+	}
+
+	standings := make([]victory.Standing, len(factions))
+	byFaction := make(map[uint]*victory.Standing, len(factions))
+	for i, faction := range factions {
+		standings[i] = victory.Standing{FactionID: faction.ID}
+		byFaction[faction.ID] = &standings[i]
+	}
+	add := func(totals []teamTotal, field func(*victory.Standing) *int) {
+		for _, total := range totals {
+			if standing, ok := byFaction[total.TeamID]; ok {
+				*field(standing) += total.Total
+			}
+		}
+	}
+	add(zones, func(s *victory.Standing) *int { return &s.ZonesHeld })
+	add(resources, func(s *victory.Standing) *int { return &s.Resources })
+	add(attackerKills, func(s *victory.Standing) *int { return &s.Kills })
+	add(defenderKills, func(s *victory.Standing) *int { return &s.Kills })
+	return standings, int(totalZones), nil
+}
+
+// evaluateVictory checks an active game instance's victory conditions against its current
+// state. The first condition met ends the game: it is marked met, the instance completes,
+// every player's stats record a win or a loss and the room is told the game is over.
+func evaluateVictory(instanceID uint) {
+	var instance models.GameInstance
+	var gameOver *GameOver
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		instance, err = lockInstance(tx, instanceID)
+		if err != nil || instance.Status != models.InstanceActive {
+			return err
+		}
+
+		var conditions []models.VictoryCondition
+		if err := tx.Where("game_instance_id = ? AND is_met = ?", instance.ID, false).Order("id").Find(&conditions).Error; err != nil {
+			return err
+		}
+		if len(conditions) == 0 {
+			return nil
+		}
+
+		standings, totalZones, err := victoryStandings(tx, instance.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, condition := range conditions {
+			thresholds, err := victory.Parse(condition.Type, condition.Details)
+			if err != nil {
+				log.Printf("Skipping invalid victory condition %d: %v", condition.ID, err)
+				continue
+			}
+			winnerID, met := victory.Winner(condition.Type, thresholds, standings, totalZones)
+			if !met {
+				continue
+			}
+
+			now := time.Now()
+			condition.IsMet = true
+			condition.WinnerFactionID = winnerID
+			condition.MetAt = &now
+			if err := tx.Save(&condition).Error; err != nil {
+				return err
+			}
+			if err := completeInstance(tx, &instance); err != nil {
+				return err
+			}
+
+			gameOver = &GameOver{GameInstanceID: instance.ID, WinnerFactionID: winnerID, Winners: []uint{}, VictoryCondition: condition}
+			if err := tx.Model(&models.FactionMember{}).Where("faction_id = ?", winnerID).Pluck("player_id", &gameOver.Winners).Error; err != nil {
+				return err
+			}
+			won := make(map[uint]bool, len(gameOver.Winners))
+			for _, playerID := range gameOver.Winners {
+				won[playerID] = true
+			}
+			for _, player := range instance.Players {
+				result := resultLoss
+				if won[player.PlayerID] {
+					result = resultWin
+				}
+				if err := recordPlayerResult(tx, player.PlayerID, result); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to evaluate victory conditions of game instance %d: %v", instanceID, err)
+		return
+	}
+	if gameOver == nil {
+		return
+	}
+
+	broadcastInstanceUpdate(instance)
+	payload, err := json.Marshal(gameOver)
+	if err != nil {
+		log.Printf("Failed to encode game over for game instance %d: %v", instance.ID, err)
+		return
+	}
+	hub.Broadcast(InstanceRoomID(instance.ID), WSMessage{Type: MessageGameOver, GameInstanceID: instance.ID, Payload: payload}, 0)
+}
+
+// ensureVictoryConditions gives a game instance the default victory condition if it has
+// none, so every game can end.
+func ensureVictoryConditions(tx *gorm.DB, instance *models.GameInstance) error {
+	var count int64
+	if err := tx.Model(&models.VictoryCondition{}).Where("game_instance_id = ?", instance.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	condition := defaultVictoryCondition
+	condition.GameInstanceID = instance.ID
+	return tx.Create(&condition).Error
+}
+
+// AddVictoryCondition lets the host add a victory condition to a pending game instance.
+func AddVictoryCondition(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+
+	var conditionRequest struct {
+		Type    string          `json:"type"`
+		Details json.RawMessage `json:"details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&conditionRequest); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	hostID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	if _, err := victory.Parse(conditionRequest.Type, string(conditionRequest.Details)); err != nil {
+		if errors.Is(err, victory.ErrUnknownType) {
+			http.Error(w, "Invalid victory condition type", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Invalid details: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	condition := models.VictoryCondition{
+		GameInstanceID: instanceID,
+		Type:           conditionRequest.Type,
+		Details:        string(conditionRequest.Details),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		instance, err := lockInstance(tx, instanceID)
+		if err != nil {
+			return err
+		}
+		if instance.HostID != hostID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the host can add victory conditions"}
+		}
+		if instance.Status != models.InstancePending {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance has already started"}
+		}
+		return tx.Create(&condition).Error
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to add victory condition")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(condition)
+}
+
+// ListVictoryConditions returns a game instance's victory conditions.
+func ListVictoryConditions(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+
+	conditions := []models.VictoryCondition{}
+	if err := db.Where("game_instance_id = ?", instanceID).Order("id").Find(&conditions).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(conditions)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"drokkit/models"
+	"gorm.io/gorm"
+)
+
+// Map generation
+const (
+	minMapSize         = 4 // Smallest map side, in zones
+	maxMapSize         = 16
+	zonesPerPlayer     = 2 // Map side added per player
+	minNeutralGarrison = 5 // Units defending an unclaimed zone
+	maxNeutralGarrison = 15
+)
+
+// MapZone is a zone with the IDs of the zones next to it.
+type MapZone struct {
+	models.Zone
+	Adjacent []uint `json:"adjacent"`
+}
+
+// ZoneMap is the territory map of a game instance.
+type ZoneMap struct {
+	GameInstanceID uint      `json:"game_instance_id"`
+	Width          int       `json:"width"`
+	Height         int       `json:"height"`
+	Zones          []MapZone `json:"zones"`
+}
+
+// ZoneCapture reports a zone changing hands.
+type ZoneCapture struct {
+	Zone              models.Zone `json:"zone"`
+	PreviousFactionID uint        `json:"previous_faction_id,omitempty"`
+	CombatLogID       uint        `json:"combat_log_id"`
+}
+
+// mapSize returns the side of the square map generated for a number of players.
+func mapSize(players int) int {
+	size := players * zonesPerPlayer
+	if size < minMapSize {
+		size = minMapSize
+	}
+	if size > maxMapSize {
+		size = maxMapSize
+	}
+	return size
+}
+
+// generateMap lays out the zones of a game instance that has just started as a grid of
+// unclaimed zones. Each zone's neutral garrison is drawn from the instance's seed, so the
+// map can be regenerated from it.
+func generateMap(tx *gorm.DB, instance *models.GameInstance) error {
+	roller, err := newInstanceRNG(tx, *instance)
+	if err != nil {
+		return err
+	}
+
+	size := mapSize(len(instance.Players))
+	zones := make([]models.Zone, 0, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			coordinates := fmt.Sprintf("%d,%d", x, y)
+			garrison, err := roller.Intn("map:zone:"+coordinates+":garrison", maxNeutralGarrison-minNeutralGarrison+1)
+			if err != nil {
+				return err
+			}
+			zones = append(zones, models.Zone{
+				GameInstanceID: instance.ID,
+				X:              x,
+				Y:              y,
+				Coordinates:    coordinates,
+				Garrison:       garrison + minNeutralGarrison,
+			})
+		}
+	}
+	if err := tx.Create(&zones).Error; err != nil {
+		return err
+	}
+
+	instance.MapWidth, instance.MapHeight = size, size
+	return tx.Model(instance).Updates(map[string]interface{}{"map_width": size, "map_height": size}).Error
+}
+
+// bordersFaction reports whether a faction may attack a zone: it must control a zone next
+// to it, unless it controls no zones yet and is picking where to land.
+func bordersFaction(tx *gorm.DB, zone models.Zone, factionID uint) (bool, error) {
+	var held int64
+	if err := tx.Model(&models.Zone{}).
+		Where("game_instance_id = ? AND controlled_by_faction_id = ?", zone.GameInstanceID, factionID).
+		Count(&held).Error; err != nil {
+		return false, err
+	}
+	if held == 0 {
+		return true, nil
+	}
+
+	var bordering int64
+	err := neighbours(tx, zone).Where("controlled_by_faction_id = ?", factionID).Count(&bordering).Error
+	return bordering > 0, err
+}
+
+// neighbours queries the zones that share an edge with a zone.
+func neighbours(tx *gorm.DB, zone models.Zone) *gorm.DB {
+	return tx.Model(&models.Zone{}).
+		Where("game_instance_id = ?", zone.GameInstanceID).
+		Where("(x = ? AND y IN ?) OR (y = ? AND x IN ?)", zone.X, []int{zone.Y - 1, zone.Y + 1}, zone.Y, []int{zone.X - 1, zone.X + 1})
+}
+
+// withAdjacency pairs each zone of a map with its neighbours.
+func withAdjacency(zones []models.Zone) []MapZone {
+	byPosition := make(map[[2]int]uint, len(zones))
+	for _, zone := range zones {
+		byPosition[[2]int{zone.X, zone.Y}] = zone.ID
+	}
+
+	mapZones := make([]MapZone, len(zones))
+	for i, zone := range zones {
+		mapZones[i] = MapZone{Zone: zone, Adjacent: []uint{}}
+		for _, step := range [][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}} {
+			if id, ok := byPosition[[2]int{zone.X + step[0], zone.Y + step[1]}]; ok {
+				mapZones[i].Adjacent = append(mapZones[i].Adjacent, id)
+			}
+		}
+	}
+	return mapZones
+}
+
+// broadcastZoneCapture tells everyone connected to a game instance's room that a zone changed hands.
+func broadcastZoneCapture(capture ZoneCapture) {
+	payload, err := json.Marshal(capture)
+	if err != nil {
+		log.Printf("Failed to encode capture of zone %d: %v", capture.Zone.ID, err)
+		return
+	}
+	hub.Broadcast(InstanceRoomID(capture.Zone.GameInstanceID), WSMessage{Type: MessageZoneCaptured, GameInstanceID: capture.Zone.GameInstanceID, Payload: payload}, 0)
+}
+
+// GetZoneMap returns a game instance's zones, in rows, with their neighbours.
+func GetZoneMap(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid game instance ID", http.StatusBadRequest)
+		return
+	}
+
+	var instance models.GameInstance
+	if err := db.First(&instance, instanceID).Error; err != nil {
+		http.Error(w, "Game instance not found", http.StatusNotFound)
+		return
+	}
+
+	var zones []models.Zone
+	if err := db.Where("game_instance_id = ?", instance.ID).Order("y, x").Find(&zones).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ZoneMap{
+		GameInstanceID: instance.ID,
+		Width:          instance.MapWidth,
+		Height:         instance.MapHeight,
+		Zones:          withAdjacency(zones),
+	})
+}
+
+// GetZone returns a zone with its neighbours.
+func GetZone(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+		return
+	}
+
+	var zone models.Zone
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		http.Error(w, "Zone not found", http.StatusNotFound)
+		return
+	}
+
+	var bordering []models.Zone
+	if err := neighbours(db, zone).Order("y, x").Find(&bordering).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	mapZone := MapZone{Zone: zone, Adjacent: []uint{}}
+	for _, neighbour := range bordering {
+		mapZone.Adjacent = append(mapZone.Adjacent, neighbour.ID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mapZone)
+}
+
+// GarrisonZone lets the leader of the faction controlling a zone move units between the
+// faction and the zone's garrison. A positive number of units is stationed in the zone and
+// a negative number withdrawn from it.
+func GarrisonZone(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+		return
+	}
+
+	var garrisonRequest struct {
+		Units int `json:"units"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&garrisonRequest); err != nil || garrisonRequest.Units == 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	playerID, ok := actingPlayer(w, r, 0)
+	if !ok {
+		return
+	}
+
+	var zone models.Zone
+	if err := db.First(&zone, zoneID).Error; err != nil {
+		http.Error(w, "Zone not found", http.StatusNotFound)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		instance, err := lockInstance(tx, zone.GameInstanceID)
+		if err != nil {
+			return err
+		}
+		if instance.Status != models.InstanceActive {
+			return &InstanceError{Status: http.StatusConflict, Message: "Game instance is not active"}
+		}
+		if zone, err = lockZone(tx, instance.ID, zone.ID); err != nil {
+			return err
+		}
+		if zone.ControlledByFactionID == 0 {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the leader of the controlling faction can garrison a zone"}
+		}
+		faction, err := lockFaction(tx, instance.ID, zone.ControlledByFactionID)
+		if err != nil {
+			return err
+		}
+		if faction.LeaderID != playerID {
+			return &InstanceError{Status: http.StatusForbidden, Message: "Only the leader of the controlling faction can garrison a zone"}
+		}
+		if garrisonRequest.Units > faction.Units || -garrisonRequest.Units > zone.Garrison {
+			return &InstanceError{Status: http.StatusConflict, Message: "Not enough units"}
+		}
+
+		zone.Garrison += garrisonRequest.Units
+		if err := tx.Model(&zone).Update("garrison", zone.Garrison).Error; err != nil {
+			return err
+		}
+		return tx.Model(&faction).Update("units", faction.Units-garrisonRequest.Units).Error
+	})
+	if err != nil {
+		writeInstanceError(w, err, "Failed to garrison zone")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(zone)
+}
+
+// captureZone hands a zone won in battle to the attacking faction, with the surviving
+// attackers as its garrison.
+func captureZone(tx *gorm.DB, zone *models.Zone, factionID uint, survivors int) error {
+	zone.ControlledByFactionID = factionID
+	zone.Garrison = survivors
+	zone.LastControlChange = time.Now()
+	return tx.Model(zone).Updates(map[string]interface{}{
+		"controlled_by_faction_id": zone.ControlledByFactionID,
+		"garrison":                 zone.Garrison,
+		"last_control_change":      zone.LastControlChange,
+	}).Error
+}
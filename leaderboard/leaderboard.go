@@ -0,0 +1,234 @@
+// Package leaderboard maintains real-time leaderboards in Redis sorted sets.
+//
+// Each game type has an all-time board scored by current rating, plus weekly and
+// monthly boards scored by the rating gained in that calendar period. Period boards
+// live under keys named after the period, so a new week or month starts a fresh
+// board automatically and old ones expire.
+//
+// Faction and alliance boards are computed from the game state and cached here for
+// a few minutes, or until the state they were computed from changes.
+package leaderboard
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Timeframes
+const (
+	AllTime = "all-time"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+// Timeframes lists every supported timeframe.
+var Timeframes = []string{AllTime, Weekly, Monthly}
+
+// How long period boards are kept after they are last written
+const (
+	weeklyTTL  = 15 * 24 * time.Hour
+	monthlyTTL = 62 * 24 * time.Hour
+)
+
+// Entry is a player's position on a board.
+type Entry struct {
+	PlayerID uint  `json:"player_id"`
+	Score    int   `json:"score"` // Rating for all-time boards, rating gained for period boards
+	Rank     int64 `json:"rank"`  // 1-based
+}
+
+// Board reads and writes leaderboards in Redis.
+type Board struct {
+	client *redis.Client
+}
+
+// New creates a board backed by the given Redis client.
+func New(client *redis.Client) *Board {
+	return &Board{client: client}
+}
+
+// ValidTimeframe reports whether the timeframe is supported.
+func ValidTimeframe(timeframe string) bool {
+	for _, t := range Timeframes {
+		if t == timeframe {
+			return true
+		}
+	}
+	return false
+}
+
+// PeriodStart returns the start of the calendar period containing at, in UTC.
+// The all-time period has no start and returns the zero time.
+func PeriodStart(timeframe string, at time.Time) time.Time {
+	at = at.UTC()
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch timeframe {
+	case Weekly:
+		// ISO weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case Monthly:
+		return time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// Key returns the Redis key of the board for a game type and timeframe at the given time.
+func Key(gameType, timeframe string, at time.Time) string {
+	at = at.UTC()
+	switch timeframe {
+	case Weekly:
+		year, week := at.ISOWeek()
+		return fmt.Sprintf("leaderboard:%s:weekly:%d-W%02d", gameType, year, week)
+	case Monthly:
+		return fmt.Sprintf("leaderboard:%s:monthly:%s", gameType, at.Format("2006-01"))
+	}
+	return fmt.Sprintf("leaderboard:%s:all-time", gameType)
+}
+
+// recordScript applies a rating change to the boards that are already built. Boards that
+// are missing are left for the next read to rebuild from the database, since a board
+// created here would hold only this one player.
+//
+// KEYS: all-time, weekly and monthly boards
+// ARGV: member, rating, delta, weekly TTL, monthly TTL (in seconds)
+var recordScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+end
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('ZINCRBY', KEYS[2], ARGV[3], ARGV[1])
+	redis.call('EXPIRE', KEYS[2], ARGV[4])
+end
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('ZINCRBY', KEYS[3], ARGV[3], ARGV[1])
+	redis.call('EXPIRE', KEYS[3], ARGV[5])
+end
+return 0
+`)
+
+// RecordResult updates every built board of the game type after a player's rating changed.
+func (b *Board) RecordResult(gameType string, playerID uint, rating, delta int, at time.Time) error {
+	keys := []string{Key(gameType, AllTime, at), Key(gameType, Weekly, at), Key(gameType, Monthly, at)}
+	return recordScript.Run(b.client, keys, member(playerID), rating, delta, int(weeklyTTL.Seconds()), int(monthlyTTL.Seconds())).Err()
+}
+
+// Drop deletes every board of the game type at the given time, so they are rebuilt on
+// the next read. It is used when a board may have missed an update.
+func (b *Board) Drop(gameType string, at time.Time) error {
+	return b.client.Del(Key(gameType, AllTime, at), Key(gameType, Weekly, at), Key(gameType, Monthly, at)).Err()
+}
+
+// Exists reports whether the board has been built.
+func (b *Board) Exists(gameType, timeframe string, at time.Time) (bool, error) {
+	n, err := b.client.Exists(Key(gameType, timeframe, at)).Result()
+	return n > 0, err
+}
+
+// Rebuild replaces a board with the given entries. The new board is written under a
+// temporary key and renamed into place so readers never see a partial board.
+func (b *Board) Rebuild(gameType, timeframe string, at time.Time, entries []Entry) error {
+	key := Key(gameType, timeframe, at)
+	if len(entries) == 0 {
+		return b.client.Del(key).Err()
+	}
+
+	members := make([]redis.Z, len(entries))
+	for i, entry := range entries {
+		members[i] = redis.Z{Score: float64(entry.Score), Member: member(entry.PlayerID)}
+	}
+
+	tmpKey := key + ":rebuild"
+	pipe := b.client.TxPipeline()
+	pipe.Del(tmpKey)
+	pipe.ZAdd(tmpKey, members...)
+	pipe.Rename(tmpKey, key)
+	switch timeframe {
+	case Weekly:
+		pipe.Expire(key, weeklyTTL)
+	case Monthly:
+		pipe.Expire(key, monthlyTTL)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// Page returns limit entries starting at the 0-based offset, best first.
+func (b *Board) Page(gameType, timeframe string, at time.Time, offset, limit int64) ([]Entry, error) {
+	return b.rangeByRank(Key(gameType, timeframe, at), offset, offset+limit-1)
+}
+
+// Rank returns a player's entry on a board. ok is false if the player is not on it.
+func (b *Board) Rank(gameType, timeframe string, at time.Time, playerID uint) (entry Entry, ok bool, err error) {
+	key := Key(gameType, timeframe, at)
+	rank, err := b.client.ZRevRank(key, member(playerID)).Result()
+	if err == redis.Nil {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+	score, err := b.client.ZScore(key, member(playerID)).Result()
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return Entry{PlayerID: playerID, Score: int(score), Rank: rank + 1}, true, nil
+}
+
+// Around returns the entries within radius places above and below a player, including the player.
+func (b *Board) Around(gameType, timeframe string, at time.Time, playerID uint, radius int64) ([]Entry, error) {
+	entry, ok, err := b.Rank(gameType, timeframe, at, playerID)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	start := entry.Rank - 1 - radius
+	if start < 0 {
+		start = 0
+	}
+	return b.rangeByRank(Key(gameType, timeframe, at), start, entry.Rank-1+radius)
+}
+
+// Size returns the number of players on a board.
+func (b *Board) Size(gameType, timeframe string, at time.Time) (int64, error) {
+	return b.client.ZCard(Key(gameType, timeframe, at)).Result()
+}
+
+// member returns the sorted set member of a player or team. Redis ranks equal scores in
+// reverse member order, so IDs are stored as their zero-padded distance below the largest
+// ID. Ties then rank by ascending ID, as they do on boards computed from the database.
+func member(id uint) string {
+	return fmt.Sprintf("%020d", uint64(math.MaxUint64)-uint64(id))
+}
+
+// memberID is the inverse of member.
+func memberID(member string) (uint, bool) {
+	n, err := strconv.ParseUint(member, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(math.MaxUint64 - n), true
+}
+
+func (b *Board) rangeByRank(key string, start, stop int64) ([]Entry, error) {
+	members, err := b.client.ZRevRangeWithScores(key, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(members))
+	for i, z := range members {
+		name, _ := z.Member.(string)
+		id, ok := memberID(name)
+		if !ok {
+			continue
+		}
+		entries = append(entries, Entry{PlayerID: id, Score: int(z.Score), Rank: start + int64(i) + 1})
+	}
+	return entries, nil
+}
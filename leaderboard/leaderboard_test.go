@@ -0,0 +1,29 @@
+package leaderboard
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMemberRoundTrip(t *testing.T) {
+	for _, id := range []uint{0, 1, 9, 10, 4096, math.MaxUint32} {
+		got, ok := memberID(member(id))
+		if !ok || got != id {
+			t.Errorf("memberID(member(%d)) = %d, %v", id, got, ok)
+		}
+	}
+	if _, ok := memberID("not-a-member"); ok {
+		t.Error("memberID parsed a malformed member")
+	}
+}
+
+func TestMembersRankTiesByAscendingID(t *testing.T) {
+	// Redis ranks equal scores in reverse member order, so a lower ID must have the
+	// greater member for it to rank first, as it does on boards built in SQL
+	ids := []uint{1, 2, 9, 10, 11, 100, 4096}
+	for i := 1; i < len(ids); i++ {
+		if lower, higher := member(ids[i-1]), member(ids[i]); lower <= higher {
+			t.Errorf("member(%d) = %s sorts before member(%d) = %s", ids[i-1], lower, ids[i], higher)
+		}
+	}
+}
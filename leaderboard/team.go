@@ -0,0 +1,158 @@
+package leaderboard
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Team kinds
+const (
+	Faction  = "faction"
+	Alliance = "alliance"
+)
+
+// Team metrics
+const (
+	ZonesHeld  = "zones_held"
+	CombatWins = "combat_wins"
+	Resources  = "resources"
+)
+
+// Metrics lists every metric a team board can be ranked by.
+var Metrics = []string{ZonesHeld, CombatWins, Resources}
+
+// teamTTL bounds how stale a cached team board can get if an invalidation is missed.
+const teamTTL = 5 * time.Minute
+
+// TeamStanding is a faction's or alliance's totals on a team board.
+type TeamStanding struct {
+	TeamID     uint  `json:"team_id"`
+	Rank       int64 `json:"rank"` // 1-based
+	ZonesHeld  int   `json:"zones_held"`
+	CombatWins int   `json:"combat_wins"`
+	Resources  int   `json:"resources"`
+}
+
+// Score returns the standing's value for a metric.
+func (s TeamStanding) Score(metric string) int {
+	switch metric {
+	case CombatWins:
+		return s.CombatWins
+	case Resources:
+		return s.Resources
+	}
+	return s.ZonesHeld
+}
+
+// SetScore sets the standing's value for a metric.
+func (s *TeamStanding) SetScore(metric string, score int) {
+	switch metric {
+	case ZonesHeld:
+		s.ZonesHeld = score
+	case CombatWins:
+		s.CombatWins = score
+	case Resources:
+		s.Resources = score
+	}
+}
+
+// ValidMetric reports whether the metric is supported.
+func ValidMetric(metric string) bool {
+	for _, m := range Metrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// TeamKey returns the Redis key of a team board ranked by metric. An instance ID of zero
+// is the board across every game instance.
+func TeamKey(kind string, instanceID uint, metric string) string {
+	if instanceID == 0 {
+		return fmt.Sprintf("leaderboard:team:%s:all:%s", kind, metric)
+	}
+	return fmt.Sprintf("leaderboard:team:%s:instance:%d:%s", kind, instanceID, metric)
+}
+
+// teamBuiltKey returns the Redis key marking a team board as cached. Redis does not keep
+// empty sorted sets, so a board with no teams is only recorded by this key.
+func teamBuiltKey(kind string, instanceID uint) string {
+	return TeamKey(kind, instanceID, "built")
+}
+
+// TeamsExist reports whether a team board is cached.
+func (b *Board) TeamsExist(kind string, instanceID uint) (bool, error) {
+	n, err := b.client.Exists(teamBuiltKey(kind, instanceID)).Result()
+	return n > 0, err
+}
+
+// RebuildTeams caches a team board, writing one sorted set per metric.
+func (b *Board) RebuildTeams(kind string, instanceID uint, standings []TeamStanding) error {
+	pipe := b.client.TxPipeline()
+	pipe.Set(teamBuiltKey(kind, instanceID), 1, teamTTL)
+	for _, metric := range Metrics {
+		key := TeamKey(kind, instanceID, metric)
+		pipe.Del(key)
+		if len(standings) == 0 {
+			continue
+		}
+
+		members := make([]redis.Z, len(standings))
+		for i, standing := range standings {
+			members[i] = redis.Z{Score: float64(standing.Score(metric)), Member: member(standing.TeamID)}
+		}
+		pipe.ZAdd(key, members...)
+		pipe.Expire(key, teamTTL)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// TeamPage returns limit standings ranked by metric, starting at the 0-based offset.
+func (b *Board) TeamPage(kind string, instanceID uint, metric string, offset, limit int64) ([]TeamStanding, error) {
+	ranked, err := b.rangeByRank(TeamKey(kind, instanceID, metric), offset, offset+limit-1)
+	if err != nil || len(ranked) == 0 {
+		return nil, err
+	}
+
+	// Fill in the other metrics for the teams on the page
+	pipe := b.client.Pipeline()
+	scores := make(map[string][]*redis.FloatCmd, len(Metrics))
+	for _, other := range Metrics {
+		if other == metric {
+			continue
+		}
+		for _, entry := range ranked {
+			scores[other] = append(scores[other], pipe.ZScore(TeamKey(kind, instanceID, other), member(entry.PlayerID)))
+		}
+	}
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	standings := make([]TeamStanding, len(ranked))
+	for i, entry := range ranked {
+		standings[i] = TeamStanding{TeamID: entry.PlayerID, Rank: entry.Rank}
+		standings[i].SetScore(metric, entry.Score)
+		for other, cmds := range scores {
+			standings[i].SetScore(other, int(cmds[i].Val()))
+		}
+	}
+	return standings, nil
+}
+
+// InvalidateTeams drops the cached team boards that include the game instance, so they
+// are rebuilt on the next read.
+func (b *Board) InvalidateTeams(instanceID uint) error {
+	var keys []string
+	for _, kind := range []string{Faction, Alliance} {
+		keys = append(keys, teamBuiltKey(kind, 0), teamBuiltKey(kind, instanceID))
+		for _, metric := range Metrics {
+			keys = append(keys, TeamKey(kind, 0, metric), TeamKey(kind, instanceID, metric))
+		}
+	}
+	return b.client.Del(keys...).Err()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -8,12 +9,17 @@ import (
 	"drokkit/config"
 	"drokkit/handlers"
 	"drokkit/routes"
+	"drokkit/sessions"
+	"github.com/go-redis/redis"
 	"github.com/nats-io/nats.go"
 )
 
 var nc *nats.Conn
 
 func main() {
+	bootstrapAdmin := flag.String("bootstrap-admin", "", "Grant every admin permission to the named player and exit")
+	flag.Parse()
+
 	// Load environment variables for configuration
 	natsURL := os.Getenv("NATS_URL")
 	if natsURL == "" {
@@ -24,6 +30,16 @@ func main() {
 	db, sqlDB := config.InitDatabase(false)
 	defer sqlDB.Close()
 
+	// Create the first admin offline, without starting the server
+	if *bootstrapAdmin != "" {
+		admin, err := handlers.BootstrapAdmin(db, *bootstrapAdmin)
+		if err != nil {
+			log.Fatalf("Failed to bootstrap admin: %v", err)
+		}
+		log.Printf("Player %q (ID %d) is now an admin with permissions %v", *bootstrapAdmin, admin.UserID, admin.Permissions)
+		return
+	}
+
 	// Initialize NATS connection
 	var err error
 	nc, err = nats.Connect(natsURL)
@@ -36,6 +52,56 @@ func main() {
 	// Pass the DB and NATS instance to handlers
 	handlers.InitHandlers(db, nc)
 
+	// Read faction types from the file designers edit, if there is one
+	if err := handlers.InitFactionTypes(os.Getenv("FACTIONS_FILE")); err != nil {
+		log.Fatalf("Failed to load faction types: %v", err)
+	}
+
+	// Keep sessions and leaderboards in Redis when it is configured so they survive restarts
+	var rdb *redis.Client
+	if os.Getenv("REDIS_ADDR") != "" {
+		rdb = config.InitRedis()
+		handlers.InitSessions(sessions.NewRedisStore(rdb))
+	} else {
+		log.Println("REDIS_ADDR not set, keeping sessions in memory and reading leaderboards from the database")
+	}
+	handlers.InitLeaderboard(db, rdb)
+
+	// Start pairing queued players
+	stopMatchmaking := make(chan struct{})
+	defer close(stopMatchmaking)
+	handlers.StartMatchmaking(stopMatchmaking)
+
+	// Start and end seasons on schedule
+	stopSeasons := make(chan struct{})
+	defer close(stopSeasons)
+	handlers.StartSeasons(stopSeasons)
+
+	// End game instances once a victory condition is met
+	stopVictory := make(chan struct{})
+	defer close(stopVictory)
+	handlers.StartVictoryEvaluator(stopVictory)
+
+	// Produce resources in active game instances
+	stopEconomy := make(chan struct{})
+	defer close(stopEconomy)
+	handlers.StartEconomy(stopEconomy)
+
+	// Expire trade offers nobody answered
+	stopTrading := make(chan struct{})
+	defer close(stopTrading)
+	handlers.StartTrading(stopTrading)
+
+	// Complete buildings and research when they are due
+	stopProjects := make(chan struct{})
+	defer close(stopProjects)
+	handlers.StartProjects(stopProjects)
+
+	// Pick up changes to the faction type file
+	stopFactionTypes := make(chan struct{})
+	defer close(stopFactionTypes)
+	handlers.StartFactionTypeReload(stopFactionTypes)
+
 	// Initialize router
 	router := routes.InitRoutes()
 
@@ -0,0 +1,102 @@
+// Package market matches buy and sell orders in a game instance's order book.
+//
+// Orders are priced in Gold per unit of the resource traded. An incoming order fills
+// against the best-priced resting orders on the other side of the book first, oldest
+// first at the same price, and every fill happens at the resting order's price.
+package market
+
+import (
+	"sort"
+
+	"drokkit/economy"
+)
+
+// Order sides, matching the MarketOrder side enum
+const (
+	Buy  = "Buy"
+	Sell = "Sell"
+)
+
+// Order is an order's place in the book.
+type Order struct {
+	ID        uint // Orders placed later have higher IDs
+	Side      string
+	Price     int // Gold per unit: the most a buyer pays or the least a seller accepts
+	Remaining int // Units not filled yet
+}
+
+// Fill is part of an incoming order traded against a resting order.
+type Fill struct {
+	RestingID uint
+	Price     int
+	Amount    int
+}
+
+// Opposite returns the side of the book an order on the given side trades against.
+func Opposite(side string) string {
+	if side == Buy {
+		return Sell
+	}
+	return Buy
+}
+
+// Fees returns the fees taken from each side of a fill: from the units the buyer receives
+// and from the Gold the seller receives, reduced by each player's trade rate.
+func (f Fill) Fees(buyerRate, sellerRate float64) (buyerFee, sellerFee int) {
+	return economy.TradeFee(f.Amount, buyerRate), economy.TradeFee(f.Amount*f.Price, sellerRate)
+}
+
+// Refund returns the Gold given back to a buyer whose order held limit Gold per unit, for
+// the units filled at a lower price.
+func (f Fill) Refund(limit int) int {
+	return (limit - f.Price) * f.Amount
+}
+
+// SortBook puts resting orders on one side of the book in priority order: best price
+// first, which is the lowest for sell orders and the highest for buy orders, then oldest.
+func SortBook(book []Order) {
+	sort.SliceStable(book, func(i, j int) bool {
+		if book[i].Price != book[j].Price {
+			if book[i].Side == Buy {
+				return book[i].Price > book[j].Price
+			}
+			return book[i].Price < book[j].Price
+		}
+		return book[i].ID < book[j].ID
+	})
+}
+
+// Crosses reports whether an incoming order can trade with a resting order.
+func Crosses(incoming, resting Order) bool {
+	switch {
+	case incoming.Side == resting.Side:
+		return false
+	case incoming.Side == Buy:
+		return incoming.Price >= resting.Price
+	default:
+		return incoming.Price <= resting.Price
+	}
+}
+
+// Match fills an incoming order against the resting orders on the other side of the
+// book, which must be in priority order (see SortBook). It stops once the incoming order is filled or
+// at the first resting order it does not cross.
+func Match(incoming Order, book []Order) []Fill {
+	var fills []Fill
+	remaining := incoming.Remaining
+	for _, resting := range book {
+		if remaining == 0 || !Crosses(incoming, resting) {
+			break
+		}
+		amount := resting.Remaining
+		if amount > remaining {
+			amount = remaining
+		}
+		if amount == 0 {
+			continue
+		}
+		fills = append(fills, Fill{RestingID: resting.ID, Price: resting.Price, Amount: amount})
+		remaining -= amount
+	}
+	return fills
+}
@@ -0,0 +1,133 @@
+package market
+
+import (
+	"reflect"
+	"testing"
+
+	"drokkit/economy"
+)
+
+func ids(book []Order) []uint {
+	list := make([]uint, len(book))
+	for i, order := range book {
+		list[i] = order.ID
+	}
+	return list
+}
+
+func TestSortBook(t *testing.T) {
+	sells := []Order{
+		{ID: 4, Side: Sell, Price: 12, Remaining: 1},
+		{ID: 1, Side: Sell, Price: 15, Remaining: 1},
+		{ID: 5, Side: Sell, Price: 10, Remaining: 1},
+		{ID: 2, Side: Sell, Price: 12, Remaining: 1},
+	}
+	SortBook(sells)
+	if got, want := ids(sells), []uint{5, 2, 4, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sell book order = %v, want %v (lowest price, then oldest)", got, want)
+	}
+
+	buys := []Order{
+		{ID: 3, Side: Buy, Price: 9, Remaining: 1},
+		{ID: 6, Side: Buy, Price: 11, Remaining: 1},
+		{ID: 1, Side: Buy, Price: 9, Remaining: 1},
+		{ID: 2, Side: Buy, Price: 7, Remaining: 1},
+	}
+	SortBook(buys)
+	if got, want := ids(buys), []uint{6, 1, 3, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buy book order = %v, want %v (highest price, then oldest)", got, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming Order
+		book     []Order
+		fills    []Fill
+	}{
+		{
+			name:     "price-time priority",
+			incoming: Order{ID: 10, Side: Buy, Price: 12, Remaining: 5},
+			book: []Order{
+				{ID: 3, Side: Sell, Price: 12, Remaining: 2},
+				{ID: 1, Side: Sell, Price: 11, Remaining: 2},
+				{ID: 2, Side: Sell, Price: 12, Remaining: 2},
+			},
+			fills: []Fill{{RestingID: 1, Price: 11, Amount: 2}, {RestingID: 2, Price: 12, Amount: 2}, {RestingID: 3, Price: 12, Amount: 1}},
+		},
+		{
+			name:     "partial fill of the incoming order",
+			incoming: Order{ID: 10, Side: Sell, Price: 8, Remaining: 10},
+			book: []Order{
+				{ID: 1, Side: Buy, Price: 9, Remaining: 3},
+				{ID: 2, Side: Buy, Price: 8, Remaining: 4},
+				{ID: 3, Side: Buy, Price: 7, Remaining: 50},
+			},
+			fills: []Fill{{RestingID: 1, Price: 9, Amount: 3}, {RestingID: 2, Price: 8, Amount: 4}},
+		},
+		{
+			name:     "partial fill of a resting order",
+			incoming: Order{ID: 10, Side: Buy, Price: 20, Remaining: 3},
+			book:     []Order{{ID: 1, Side: Sell, Price: 15, Remaining: 8}},
+			fills:    []Fill{{RestingID: 1, Price: 15, Amount: 3}},
+		},
+		{
+			name:     "no crossing orders",
+			incoming: Order{ID: 10, Side: Buy, Price: 5, Remaining: 3},
+			book:     []Order{{ID: 1, Side: Sell, Price: 6, Remaining: 8}},
+		},
+		{
+			name:     "same side never trades",
+			incoming: Order{ID: 10, Side: Buy, Price: 50, Remaining: 3},
+			book:     []Order{{ID: 1, Side: Buy, Price: 6, Remaining: 8}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := append([]Order(nil), test.book...)
+			SortBook(book)
+			fills := Match(test.incoming, book)
+			if !reflect.DeepEqual(fills, test.fills) {
+				t.Errorf("Match = %+v, want %+v", fills, test.fills)
+			}
+		})
+	}
+}
+
+func TestFillRefund(t *testing.T) {
+	// A buyer bidding 12 who is filled against a seller asking 10 gets 2 Gold back per unit
+	fills := Match(Order{ID: 10, Side: Buy, Price: 12, Remaining: 5}, []Order{{ID: 1, Side: Sell, Price: 10, Remaining: 5}})
+	if len(fills) != 1 {
+		t.Fatalf("Match = %+v, want one fill", fills)
+	}
+	if refund := fills[0].Refund(12); refund != 10 {
+		t.Errorf("Refund = %d, want 10", refund)
+	}
+	if refund := (Fill{Price: 12, Amount: 5}).Refund(12); refund != 0 {
+		t.Errorf("Refund at the buyer's price = %d, want 0", refund)
+	}
+}
+
+func TestFillFees(t *testing.T) {
+	tests := []struct {
+		name                  string
+		fill                  Fill
+		buyerRate, sellerRate float64
+		buyerFee, sellerFee   int
+	}{
+		{"base rate", Fill{Price: 10, Amount: 20}, 1, 1, 2, 20},
+		{"higher trade rate pays less", Fill{Price: 10, Amount: 30}, 1.5, 1.5, 2, 20},
+		{"no trade rate pays the base fee", Fill{Price: 10, Amount: 20}, 0, -1, 2, 20},
+		{"small fills round to nothing", Fill{Price: 1, Amount: 4}, 1, 1, 0, 0},
+	}
+	for _, test := range tests {
+		buyerFee, sellerFee := test.fill.Fees(test.buyerRate, test.sellerRate)
+		if buyerFee != test.buyerFee || sellerFee != test.sellerFee {
+			t.Errorf("%s: Fees = %d, %d, want %d, %d", test.name, buyerFee, sellerFee, test.buyerFee, test.sellerFee)
+		}
+		if buyerFee != economy.TradeFee(test.fill.Amount, test.buyerRate) || sellerFee != economy.TradeFee(test.fill.Amount*test.fill.Price, test.sellerRate) {
+			t.Errorf("%s: Fees disagree with economy.TradeFee", test.name)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package matchmaking pairs queued players of similar skill into matches.
+package matchmaking
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrAlreadyQueued is returned when a player who is already waiting enqueues again.
+var ErrAlreadyQueued = errors.New("player is already queued")
+
+// Preferences are the optional matchmaking settings a player can choose.
+type Preferences struct {
+	MaxRatingGap int `json:"max_rating_gap,omitempty"` // Never widen the search beyond this rating difference
+}
+
+// Ticket is a player waiting in the queue.
+type Ticket struct {
+	PlayerID    uint        `json:"player_id"`
+	GameType    string      `json:"game_type"`
+	Rating      int         `json:"rating"`
+	Preferences Preferences `json:"preferences"`
+	EnqueuedAt  time.Time   `json:"enqueued_at"`
+}
+
+// Pair is two tickets matched against each other. First is the ticket that waited longest.
+type Pair struct {
+	First  Ticket
+	Second Ticket
+}
+
+// Queue stores waiting tickets.
+type Queue interface {
+	// Add puts a ticket in the queue. It fails with ErrAlreadyQueued if the player is already waiting.
+	Add(ticket Ticket) error
+	// Remove takes a player's ticket out of the queue and reports whether there was one.
+	Remove(playerID uint) bool
+	// Get returns a player's ticket.
+	Get(playerID uint) (Ticket, bool)
+	// Tickets returns a snapshot of all waiting tickets.
+	Tickets() []Ticket
+}
+
+// Clock tells the current time. It is swapped for a fake in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the wall clock.
+type RealClock struct{}
+
+// Now returns the current time.
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Window controls how far apart in rating two players may be, growing with the time waited.
+type Window struct {
+	Initial  int           // Rating gap accepted as soon as a player is queued
+	Step     int           // Added to the gap every Interval
+	Interval time.Duration // How often the gap widens
+	Max      int           // Upper bound on the gap
+}
+
+// DefaultWindow starts narrow and reaches its maximum after about a minute and a half.
+var DefaultWindow = Window{Initial: 50, Step: 50, Interval: 10 * time.Second, Max: 500}
+
+// Gap returns the rating gap a ticket accepts at the given time.
+func (w Window) Gap(ticket Ticket, now time.Time) int {
+	gap := w.Initial
+	if w.Interval > 0 {
+		gap += int(now.Sub(ticket.EnqueuedAt)/w.Interval) * w.Step
+	}
+	if gap > w.Max {
+		gap = w.Max
+	}
+	if ticket.Preferences.MaxRatingGap > 0 && gap > ticket.Preferences.MaxRatingGap {
+		gap = ticket.Preferences.MaxRatingGap
+	}
+	return gap
+}
+
+// Service runs matchmaking over a queue.
+type Service struct {
+	queue   Queue
+	clock   Clock
+	window  Window
+	onMatch func(Pair)
+	mu      sync.Mutex // Serializes ticks so a ticket is never matched twice
+}
+
+// NewService creates a matchmaking service. onMatch is called for every pair found.
+func NewService(queue Queue, clock Clock, window Window, onMatch func(Pair)) *Service {
+	return &Service{queue: queue, clock: clock, window: window, onMatch: onMatch}
+}
+
+// Enqueue adds a player to the queue, stamping the ticket with the current time.
+func (s *Service) Enqueue(ticket Ticket) (Ticket, error) {
+	ticket.EnqueuedAt = s.clock.Now()
+	if err := s.queue.Add(ticket); err != nil {
+		return Ticket{}, err
+	}
+	return ticket, nil
+}
+
+// Requeue puts a ticket back without resetting how long it has waited.
+func (s *Service) Requeue(ticket Ticket) error {
+	return s.queue.Add(ticket)
+}
+
+// Leave removes a player from the queue.
+func (s *Service) Leave(playerID uint) bool {
+	return s.queue.Remove(playerID)
+}
+
+// Status returns a player's ticket and the rating gap it currently accepts.
+func (s *Service) Status(playerID uint) (Ticket, int, bool) {
+	ticket, ok := s.queue.Get(playerID)
+	if !ok {
+		return Ticket{}, 0, false
+	}
+	return ticket, s.window.Gap(ticket, s.clock.Now()), true
+}
+
+// Waited returns how long a ticket has been queued, by the service's clock.
+func (s *Service) Waited(ticket Ticket) time.Duration {
+	return s.clock.Now().Sub(ticket.EnqueuedAt)
+}
+
+// Tick pairs up every compatible ticket currently queued, removes them from the
+// queue and hands each pair to the onMatch callback. A pair is dropped if either player
+// left the queue after the tickets were read; the other player keeps their place.
+func (s *Service) Tick() []Pair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := FindPairs(s.queue.Tickets(), s.window, s.clock.Now())
+	pairs := make([]Pair, 0, len(found))
+	for _, pair := range found {
+		first := s.queue.Remove(pair.First.PlayerID)
+		second := s.queue.Remove(pair.Second.PlayerID)
+		if first && second {
+			pairs = append(pairs, pair)
+			continue
+		}
+		if first {
+			s.Requeue(pair.First)
+		}
+		if second {
+			s.Requeue(pair.Second)
+		}
+	}
+	for _, pair := range pairs {
+		if s.onMatch != nil {
+			s.onMatch(pair)
+		}
+	}
+	return pairs
+}
+
+// Run calls Tick every interval until stop is closed.
+func (s *Service) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Tick()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// FindPairs greedily matches tickets, oldest first. Each ticket is paired with the
+// closest rated waiting ticket for the same game type, provided the rating gap fits
+// within the wider of the two tickets' windows and neither player's preferred maximum.
+func FindPairs(tickets []Ticket, window Window, now time.Time) []Pair {
+	sorted := make([]Ticket, len(tickets))
+	copy(sorted, tickets)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].EnqueuedAt.Before(sorted[j].EnqueuedAt)
+	})
+
+	matched := make([]bool, len(sorted))
+	var pairs []Pair
+
+	for i, ticket := range sorted {
+		if matched[i] {
+			continue
+		}
+
+		best := -1
+		bestGap := 0
+		for j := i + 1; j < len(sorted); j++ {
+			candidate := sorted[j]
+			if matched[j] || candidate.GameType != ticket.GameType {
+				continue
+			}
+
+			gap := abs(ticket.Rating - candidate.Rating)
+			if gap > allowedGap(ticket, candidate, window, now) {
+				continue
+			}
+			if best == -1 || gap < bestGap {
+				best, bestGap = j, gap
+			}
+		}
+
+		if best != -1 {
+			matched[i], matched[best] = true, true
+			pairs = append(pairs, Pair{First: ticket, Second: sorted[best]})
+		}
+	}
+	return pairs
+}
+
+func allowedGap(a, b Ticket, window Window, now time.Time) int {
+	gap := window.Gap(a, now)
+	if other := window.Gap(b, now); other > gap {
+		gap = other
+	}
+	// A player's preferred maximum is a hard limit even when the other player has waited longer
+	for _, t := range []Ticket{a, b} {
+		if t.Preferences.MaxRatingGap > 0 && gap > t.Preferences.MaxRatingGap {
+			gap = t.Preferences.MaxRatingGap
+		}
+	}
+	return gap
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
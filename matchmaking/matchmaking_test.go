@@ -0,0 +1,189 @@
+package matchmaking
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var testWindow = Window{Initial: 50, Step: 50, Interval: 10 * time.Second, Max: 200}
+
+func TestWindowGap(t *testing.T) {
+	ticket := Ticket{PlayerID: 1, EnqueuedAt: testStart}
+	tests := []struct {
+		waited time.Duration
+		want   int
+	}{
+		{0, 50},
+		{9 * time.Second, 50},
+		{10 * time.Second, 100},
+		{25 * time.Second, 150},
+		{30 * time.Second, 200},
+		{time.Hour, 200}, // Capped at Max
+	}
+	for _, test := range tests {
+		if got := testWindow.Gap(ticket, testStart.Add(test.waited)); got != test.want {
+			t.Errorf("Gap after %v = %d, want %d", test.waited, got, test.want)
+		}
+	}
+
+	ticket.Preferences.MaxRatingGap = 80
+	if got := testWindow.Gap(ticket, testStart.Add(time.Hour)); got != 80 {
+		t.Errorf("Gap with a preferred maximum of 80 = %d, want 80", got)
+	}
+}
+
+func TestFindPairsWithinGap(t *testing.T) {
+	tickets := []Ticket{
+		{PlayerID: 1, GameType: "chess", Rating: 1000, EnqueuedAt: testStart},
+		{PlayerID: 2, GameType: "chess", Rating: 1100, EnqueuedAt: testStart},
+	}
+
+	// A gap of 100 is outside the initial window of 50
+	if pairs := FindPairs(tickets, testWindow, testStart); len(pairs) != 0 {
+		t.Errorf("FindPairs paired tickets 100 apart with a gap of 50: %+v", pairs)
+	}
+	// and inside it once the window has widened to 100
+	pairs := FindPairs(tickets, testWindow, testStart.Add(10*time.Second))
+	if len(pairs) != 1 {
+		t.Fatalf("FindPairs found %d pairs once the window widened, want 1", len(pairs))
+	}
+
+	// Tickets for different game types are never paired
+	tickets[1].GameType = "tictactoe"
+	if pairs := FindPairs(tickets, testWindow, testStart.Add(time.Hour)); len(pairs) != 0 {
+		t.Errorf("FindPairs paired tickets for different game types: %+v", pairs)
+	}
+}
+
+func TestFindPairsPrefersLongestWaiting(t *testing.T) {
+	tickets := []Ticket{
+		{PlayerID: 1, GameType: "chess", Rating: 1000, EnqueuedAt: testStart.Add(20 * time.Second)},
+		{PlayerID: 2, GameType: "chess", Rating: 1010, EnqueuedAt: testStart},
+		{PlayerID: 3, GameType: "chess", Rating: 1030, EnqueuedAt: testStart.Add(10 * time.Second)},
+	}
+	now := testStart.Add(20 * time.Second)
+
+	// Player 2 waited longest, so they are matched first, with the closest rated player
+	pairs := FindPairs(tickets, testWindow, now)
+	if len(pairs) != 1 {
+		t.Fatalf("FindPairs found %d pairs, want 1", len(pairs))
+	}
+	if pairs[0].First.PlayerID != 2 || pairs[0].Second.PlayerID != 1 {
+		t.Errorf("FindPairs paired %d with %d, want 2 with 1", pairs[0].First.PlayerID, pairs[0].Second.PlayerID)
+	}
+}
+
+func TestTickRemovesPairedTickets(t *testing.T) {
+	clock := &fakeClock{now: testStart}
+	queue := NewMemoryQueue()
+	var matched []Pair
+	service := NewService(queue, clock, testWindow, func(pair Pair) {
+		matched = append(matched, pair)
+	})
+
+	for _, ticket := range []Ticket{
+		{PlayerID: 1, GameType: "chess", Rating: 1000},
+		{PlayerID: 2, GameType: "chess", Rating: 1120},
+		{PlayerID: 3, GameType: "chess", Rating: 2000},
+	} {
+		if _, err := service.Enqueue(ticket); err != nil {
+			t.Fatalf("Enqueue(%d): %v", ticket.PlayerID, err)
+		}
+	}
+
+	if pairs := service.Tick(); len(pairs) != 0 {
+		t.Fatalf("Tick paired players before their windows widened: %+v", pairs)
+	}
+
+	clock.Advance(20 * time.Second)
+	pairs := service.Tick()
+	if len(pairs) != 1 || len(matched) != 1 {
+		t.Fatalf("Tick found %d pairs and matched %d, want 1", len(pairs), len(matched))
+	}
+	for _, playerID := range []uint{1, 2} {
+		if _, ok := queue.Get(playerID); ok {
+			t.Errorf("player %d is still queued after being paired", playerID)
+		}
+	}
+	if _, ok := queue.Get(3); !ok {
+		t.Error("unpaired player 3 was removed from the queue")
+	}
+}
+
+// leavingQueue is a queue in which a player leaves straight after the tickets are read.
+type leavingQueue struct {
+	*MemoryQueue
+	leaver uint
+}
+
+func (q leavingQueue) Tickets() []Ticket {
+	tickets := q.MemoryQueue.Tickets()
+	q.MemoryQueue.Remove(q.leaver)
+	return tickets
+}
+
+func TestTickDropsPairWhenPlayerLeaves(t *testing.T) {
+	clock := &fakeClock{now: testStart}
+	queue := leavingQueue{MemoryQueue: NewMemoryQueue(), leaver: 2}
+	service := NewService(queue, clock, testWindow, func(pair Pair) {
+		t.Errorf("onMatch called for a player who left: %+v", pair)
+	})
+
+	first, err := service.Enqueue(Ticket{PlayerID: 1, GameType: "chess", Rating: 1000})
+	if err != nil {
+		t.Fatalf("Enqueue(1): %v", err)
+	}
+	clock.Advance(time.Second)
+	if _, err := service.Enqueue(Ticket{PlayerID: 2, GameType: "chess", Rating: 1000}); err != nil {
+		t.Fatalf("Enqueue(2): %v", err)
+	}
+
+	if pairs := service.Tick(); len(pairs) != 0 {
+		t.Errorf("Tick paired a player who left: %+v", pairs)
+	}
+	ticket, ok := queue.Get(1)
+	if !ok {
+		t.Fatal("the remaining player was not requeued")
+	}
+	if !ticket.EnqueuedAt.Equal(first.EnqueuedAt) {
+		t.Errorf("requeued ticket was enqueued at %v, want its original time %v", ticket.EnqueuedAt, first.EnqueuedAt)
+	}
+}
+
+func TestStatusUsesClock(t *testing.T) {
+	clock := &fakeClock{now: testStart}
+	service := NewService(NewMemoryQueue(), clock, testWindow, nil)
+	if _, err := service.Enqueue(Ticket{PlayerID: 1, GameType: "chess", Rating: 1000}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	clock.Advance(25 * time.Second)
+	ticket, gap, ok := service.Status(1)
+	if !ok {
+		t.Fatal("Status did not find the queued player")
+	}
+	if waited := service.Waited(ticket); waited != 25*time.Second {
+		t.Errorf("Waited = %v, want 25s", waited)
+	}
+	if gap != 150 {
+		t.Errorf("Status gap = %d, want 150", gap)
+	}
+	if _, _, ok := service.Status(2); ok {
+		t.Error("Status found a player who is not queued")
+	}
+}
@@ -0,0 +1,59 @@
+package matchmaking
+
+import "sync"
+
+// MemoryQueue keeps tickets in process memory.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	tickets map[uint]Ticket
+}
+
+// NewMemoryQueue creates an empty in-memory queue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{tickets: make(map[uint]Ticket)}
+}
+
+// Add puts a ticket in the queue.
+func (q *MemoryQueue) Add(ticket Ticket) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.tickets[ticket.PlayerID]; ok {
+		return ErrAlreadyQueued
+	}
+	q.tickets[ticket.PlayerID] = ticket
+	return nil
+}
+
+// Remove takes a player's ticket out of the queue.
+func (q *MemoryQueue) Remove(playerID uint) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.tickets[playerID]; !ok {
+		return false
+	}
+	delete(q.tickets, playerID)
+	return true
+}
+
+// Get returns a player's ticket.
+func (q *MemoryQueue) Get(playerID uint) (Ticket, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ticket, ok := q.tickets[playerID]
+	return ticket, ok
+}
+
+// Tickets returns a snapshot of all waiting tickets.
+func (q *MemoryQueue) Tickets() []Ticket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tickets := make([]Ticket, 0, len(q.tickets))
+	for _, ticket := range q.tickets {
+		tickets = append(tickets, ticket)
+	}
+	return tickets
+}
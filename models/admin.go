@@ -2,14 +2,93 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
+// Permission is a single administrative capability.
+type Permission string
+
+// Administrative permissions
+const (
+	PermissionManageAdmins  Permission = "manage_admins"  // Grant and revoke admin permissions
+	PermissionManagePlayers Permission = "manage_players" // Delete and moderate player accounts
+	PermissionManageGames   Permission = "manage_games"   // Manage game instances, seasons and game data
+)
+
+// AllPermissions lists every known permission.
+var AllPermissions = Permissions{PermissionManageAdmins, PermissionManagePlayers, PermissionManageGames}
+
+// Permissions is a set of permissions, stored as a JSON array.
+type Permissions []Permission
+
+// Has reports whether the set contains the permission.
+func (p Permissions) Has(permission Permission) bool {
+	for _, granted := range p {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether every permission in the set is known.
+func (p Permissions) Valid() bool {
+	for _, permission := range p {
+		if !AllPermissions.Has(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// Value implements driver.Valuer.
+func (p Permissions) Value() (driver.Value, error) {
+	if p == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner. Values written before permissions were structured
+// are free-form strings and are read as a comma separated list.
+func (p *Permissions) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		raw = string(v)
+	case string:
+		raw = v
+	default:
+		return errors.New("unsupported type for Permissions")
+	}
+
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "[") {
+		return json.Unmarshal([]byte(raw), p)
+	}
+
+	*p = nil
+	for _, permission := range strings.Split(raw, ",") {
+		if permission = strings.TrimSpace(permission); permission != "" {
+			*p = append(*p, Permission(permission))
+		}
+	}
+	return nil
+}
+
 // Admin represents an administrative user with specific permissions.
 type Admin struct {
 	gorm.Model
-	UserID      uint      `json:"user_id" gorm:"unique"`
-	Permissions string    `json:"permissions"` // Define permission levels as needed
-	AssignedAt  time.Time `json:"assigned_at"`
+	UserID      uint        `json:"user_id" gorm:"unique"`
+	Permissions Permissions `json:"permissions" gorm:"type:text"`
+	AssignedAt  time.Time   `json:"assigned_at"`
 }
@@ -7,9 +7,10 @@ import (
 // CombatLog represents a combat event between two players or factions.
 type CombatLog struct {
 	gorm.Model
-	GameInstanceID    uint          `json:"game_instance_id"`
-	AttackerID        uint          `json:"attacker_id"`
-	DefenderID        uint          `json:"defender_id"`
+	GameInstanceID    uint          `gorm:"index" json:"game_instance_id"`
+	AttackerID        uint          `json:"attacker_id"`       // Attacking faction
+	DefenderID        uint          `json:"defender_id"`       // Defending faction, 0 for an unclaimed zone
+	ZoneID            uint          `json:"zone_id,omitempty"` // Zone attacked, if any
 	UnitsLostAttacker int           `json:"units_lost_attacker"`
 	UnitsLostDefender int           `json:"units_lost_defender"`
 	Outcome           string        `gorm:"type:enum('Attacker Wins','Defender Wins','Draw');not null" json:"outcome"`
@@ -21,5 +22,6 @@ type CombatLog struct {
 type CombatEvent struct {
 	gorm.Model
 	CombatLogID uint   `json:"combat_log_id"`
+	Round       int    `json:"round"`
 	EventDetail string `json:"event_detail"` // JSON-encoded detailed event
 }
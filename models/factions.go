@@ -10,7 +10,7 @@ import (
 type Faction struct {
 	gorm.Model
 	GameInstanceID  uint            `json:"game_instance_id"`
-	FactionType     string          `gorm:"type:enum('Industrialists','Warriors','Technologists','Traders');not null" json:"faction_type"`
+	FactionType     string          `gorm:"size:64;not null" json:"faction_type"` // Archetype the faction was created from
 	LeaderID        uint            `json:"leader_id"`
 	ResourceBonus   float64         `json:"resource_bonus"`
 	CombatBonus     float64         `json:"combat_bonus"`
@@ -18,14 +18,17 @@ type Faction struct {
 	ResearchSpeed   float64         `json:"research_speed"`
 	TradeRate       float64         `json:"trade_rate"`
 	DefenseStrength float64         `json:"defense_strength"`
+	Units           int             `json:"units"` // Units available to fight
 	FactionMembers  []FactionMember `json:"faction_members"`
-	ControlledZones []Zone          `json:"controlled_zones"`
+	ControlledZones []Zone          `gorm:"foreignKey:ControlledByFactionID" json:"controlled_zones"`
 }
 
-// FactionMember represents a player within a faction.
+// FactionMember represents a player within a faction. A player belongs to at most one
+// faction in each game instance.
 type FactionMember struct {
 	gorm.Model
-	FactionID uint      `json:"faction_id"`
-	PlayerID  uint      `json:"player_id"`
-	JoinedAt  time.Time `json:"joined_at"`
+	GameInstanceID uint      `gorm:"uniqueIndex:idx_faction_member_player" json:"game_instance_id"` // The faction's game instance
+	FactionID      uint      `json:"faction_id"`
+	PlayerID       uint      `gorm:"uniqueIndex:idx_faction_member_player" json:"player_id"`
+	JoinedAt       time.Time `json:"joined_at"`
 }
@@ -1,21 +1,42 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Game instance statuses
+const (
+	InstancePending   = "Pending"
+	InstanceActive    = "Active"
+	InstanceCompleted = "Completed"
+)
+
 // GameInstance represents an active game with its settings and state.
 type GameInstance struct {
 	gorm.Model
-	LobbyID           uint               `json:"lobby_id"`
-	Status            string             `gorm:"type:enum('Pending','Active','Completed');default:'Pending'" json:"status"`
-	StartedAt         string             `json:"started_at"`
-	EndedAt           string             `json:"ended_at"`
-	RandomSeed        string             `json:"random_seed"`
-	Players           []Player           `json:"players"`
-	Factions          []Faction          `json:"factions"`
-	Resources         []Resource         `json:"resources"`
-	CombatLogs        []CombatLog        `json:"combat_logs"`
-	Alliances         []Alliance         `json:"alliances"`
-	VictoryConditions []VictoryCondition `json:"victory_conditions"`
+	LobbyID           uint                 `json:"lobby_id"`
+	HostID            uint                 `json:"host_id"`
+	MaxPlayers        int                  `json:"max_players"`
+	Status            string               `gorm:"type:enum('Pending','Active','Completed');default:'Pending'" json:"status"`
+	StartedAt         *time.Time           `json:"started_at,omitempty"`
+	EndedAt           *time.Time           `json:"ended_at,omitempty"`
+	MapWidth          int                  `json:"map_width"`
+	MapHeight         int                  `json:"map_height"`
+	RandomSeed        string               `json:"-"` // Kept secret so players cannot predict draws
+	Players           []GameInstancePlayer `json:"players"`
+	Factions          []Faction            `json:"factions"`
+	Resources         []Resource           `json:"resources"`
+	CombatLogs        []CombatLog          `json:"combat_logs"`
+	Alliances         []Alliance           `json:"alliances"`
+	VictoryConditions []VictoryCondition   `json:"victory_conditions"`
+}
+
+// GameInstancePlayer represents a player who has joined a game instance.
+type GameInstancePlayer struct {
+	gorm.Model
+	GameInstanceID uint      `gorm:"uniqueIndex:idx_instance_player" json:"game_instance_id"`
+	PlayerID       uint      `gorm:"uniqueIndex:idx_instance_player" json:"player_id"`
+	JoinedAt       time.Time `json:"joined_at"`
 }
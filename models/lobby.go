@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lobby statuses
+const (
+	LobbyOpen    = "Open"
+	LobbyStarted = "Started"
+	LobbyClosed  = "Closed"
+)
+
+// Lobby is where players gather and get ready before a game instance starts.
+type Lobby struct {
+	gorm.Model
+	Name           string          `json:"name"`
+	Code           string          `gorm:"uniqueIndex;size:16" json:"code"` // Shared to let players join, including private lobbies
+	HostID         uint            `json:"host_id"`
+	IsPrivate      bool            `json:"is_private"`
+	MaxPlayers     int             `json:"max_players"`
+	Settings       json.RawMessage `json:"settings"` // JSON-encoded game settings chosen by the host
+	Status         string          `gorm:"type:enum('Open','Started','Closed');default:'Open'" json:"status"`
+	GameInstanceID uint            `json:"game_instance_id,omitempty"` // Set once the lobby has started
+	Members        []LobbyMember   `json:"members"`
+}
+
+// LobbyMember represents a player in a lobby.
+type LobbyMember struct {
+	gorm.Model
+	LobbyID  uint      `gorm:"uniqueIndex:idx_lobby_member" json:"lobby_id"`
+	PlayerID uint      `gorm:"uniqueIndex:idx_lobby_member" json:"player_id"`
+	Ready    bool      `json:"ready"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// LobbyChat represents a chat message sent in a lobby.
+type LobbyChat struct {
+	gorm.Model
+	LobbyID   uint      `gorm:"index" json:"lobby_id"`
+	UserID    uint      `json:"user_id"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -3,13 +3,26 @@ package models
 import (
 	"encoding/json"
 	"gorm.io/gorm"
+	"time"
+)
+
+// Match lifecycle states
+const (
+	MatchPending   = "Pending"
+	MatchActive    = "Active"
+	MatchFinished  = "Finished"
+	MatchAbandoned = "Abandoned"
 )
 
 // Match represents a game match between two players.
 type Match struct {
 	gorm.Model
-	PlayerOne uint            `json:"player_one"`
-	PlayerTwo uint            `json:"player_two"`
-	GameState json.RawMessage `json:"game_state"` // JSON-encoded game state
-	Turn      uint            `json:"turn"`
+	PlayerOne  uint            `json:"player_one"`
+	PlayerTwo  uint            `json:"player_two"`
+	GameType   string          `gorm:"default:'freeform'" json:"game_type"` // Name of the ruleset the match is played with
+	GameState  json.RawMessage `json:"game_state"`                          // JSON-encoded game state
+	Turn       uint            `json:"turn"`
+	Status     string          `gorm:"type:enum('Pending','Active','Finished','Abandoned');default:'Pending'" json:"status"`
+	WinnerID   uint            `json:"winner_id,omitempty"` // Zero while the match is running or when it ended in a draw
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
 }
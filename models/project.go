@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Project statuses
+const (
+	ProjectQueued    = "Queued"
+	ProjectCompleted = "Completed"
+	ProjectCancelled = "Cancelled"
+)
+
+// Project is a building or piece of research in a player's queue within a game instance.
+// Each player has one queue per kind, and its projects run one after another.
+type Project struct {
+	gorm.Model
+	GameInstanceID uint            `gorm:"index:idx_project_queue" json:"game_instance_id"`
+	PlayerID       uint            `gorm:"index:idx_project_queue" json:"player_id"`
+	Kind           string          `gorm:"type:enum('Building','Research');not null;index:idx_project_queue" json:"kind"`
+	Name           string          `json:"name"`
+	Cost           json.RawMessage `json:"cost"`     // JSON-encoded resources spent
+	Duration       int             `json:"duration"` // Seconds, after the faction's speed bonus
+	StartsAt       time.Time       `json:"starts_at"`
+	CompletesAt    time.Time       `gorm:"index" json:"completes_at"`
+	Status         string          `gorm:"type:enum('Queued','Completed','Cancelled');default:'Queued'" json:"status"`
+	CompletedAt    *time.Time      `json:"completed_at,omitempty"`
+	Refund         json.RawMessage `json:"refund,omitempty"` // JSON-encoded resources given back on cancellation
+}
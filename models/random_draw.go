@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RandomDraw records a random number drawn for a game instance, so the game can be
+// replayed from its seed.
+type RandomDraw struct {
+	gorm.Model
+	GameInstanceID uint   `gorm:"uniqueIndex:idx_instance_draw" json:"game_instance_id"`
+	Sequence       uint64 `gorm:"uniqueIndex:idx_instance_draw" json:"sequence"`
+	Purpose        string `json:"purpose"` // What the draw decided, e.g. "combat:12:round:1"
+	Bound          int    `json:"bound"`   // The value was drawn from [0, Bound)
+	Value          int    `json:"value"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Rating is a player's skill rating for one game type.
+type Rating struct {
+	gorm.Model
+	PlayerID    uint   `gorm:"uniqueIndex:idx_rating_player_game" json:"player_id"`
+	GameType    string `gorm:"uniqueIndex:idx_rating_player_game;size:64" json:"game_type"`
+	Rating      int    `json:"rating"`
+	GamesPlayed int    `json:"games_played"`
+}
+
+// RatingHistory records every rating change, so rating gains over a period can be computed.
+type RatingHistory struct {
+	gorm.Model
+	PlayerID     uint   `gorm:"index" json:"player_id"`
+	GameType     string `gorm:"index;size:64" json:"game_type"`
+	MatchID      uint   `json:"match_id"`
+	RatingBefore int    `json:"rating_before"`
+	RatingAfter  int    `json:"rating_after"`
+	Delta        int    `json:"delta"`
+}
@@ -7,9 +7,21 @@ import (
 // Resource represents a resource within a game instance.
 type Resource struct {
 	gorm.Model
-	GameInstanceID uint   `json:"game_instance_id"`
-	PlayerID       uint   `json:"player_id,omitempty"` // Nullable for global resources
-	Type           string `gorm:"type:enum('Gold','Wood','Stone', etc.);not null" json:"type"`
+	GameInstanceID uint   `gorm:"uniqueIndex:idx_resource_owner" json:"game_instance_id"`
+	PlayerID       uint   `gorm:"uniqueIndex:idx_resource_owner" json:"player_id,omitempty"`   // Nullable for global resources
+	Type           string `gorm:"size:32;not null;uniqueIndex:idx_resource_owner" json:"type"` // One of the types in economy.Catalog
 	Amount         int    `json:"amount"`
 	LastUpdated    string `json:"last_updated"`
 }
+
+// ResourceLedger records a change to a player's resources and why it happened.
+type ResourceLedger struct {
+	gorm.Model
+	GameInstanceID uint   `gorm:"index:idx_ledger_owner" json:"game_instance_id"`
+	PlayerID       uint   `gorm:"index:idx_ledger_owner" json:"player_id"`
+	Type           string `json:"type"`
+	Delta          int    `json:"delta"`
+	Balance        int    `json:"balance"` // Amount held after the change
+	Reason         string `json:"reason"`
+	ReferenceID    uint   `json:"reference_id,omitempty"` // Player, trade or other record the change relates to
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Season statuses
+const (
+	SeasonScheduled = "Scheduled"
+	SeasonActive    = "Active"
+	SeasonArchived  = "Archived"
+)
+
+// Season is a period of ranked play. When a season ends its final standings and player
+// stats are archived and ratings are soft-reset for the next season.
+type Season struct {
+	gorm.Model
+	Name       string     `json:"name"`
+	StartsAt   time.Time  `json:"starts_at"`
+	EndsAt     time.Time  `json:"ends_at"`
+	Status     string     `gorm:"type:enum('Scheduled','Active','Archived');default:'Scheduled'" json:"status"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// SeasonStanding is a player's final position on a season's leaderboard for a game type.
+type SeasonStanding struct {
+	gorm.Model
+	SeasonID         uint   `gorm:"index:idx_season_standing,priority:1" json:"season_id"`
+	GameType         string `gorm:"index:idx_season_standing,priority:2;size:64" json:"game_type"`
+	PlayerID         uint   `json:"player_id"`
+	Rank             int64  `json:"rank"`
+	Rating           int    `json:"rating"`        // Rating when the season ended, before the reset
+	RatingChange     int    `json:"rating_change"` // Rating gained during the season
+	GamesPlayed      int    `json:"games_played"`
+	RewardExperience int    `json:"reward_experience"`
+}
+
+// SeasonStats is a snapshot of a player's stats taken when a season ended.
+type SeasonStats struct {
+	gorm.Model
+	SeasonID    uint `gorm:"index" json:"season_id"`
+	PlayerID    uint `gorm:"index" json:"player_id"`
+	Wins        int  `json:"wins"`
+	Losses      int  `json:"losses"`
+	GamesPlayed int  `json:"games_played"`
+	Experience  int  `json:"experience"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trade offer statuses
+const (
+	TradePending   = "Pending"
+	TradeAccepted  = "Accepted"
+	TradeDeclined  = "Declined"
+	TradeCountered = "Countered"
+	TradeCancelled = "Cancelled"
+	TradeExpired   = "Expired"
+)
+
+// Market order statuses
+const (
+	OrderOpen      = "Open"
+	OrderFilled    = "Filled"
+	OrderCancelled = "Cancelled"
+)
+
+// TradeOffer is an offer from one player to another to swap resources.
+type TradeOffer struct {
+	gorm.Model
+	GameInstanceID uint       `gorm:"index" json:"game_instance_id"`
+	FromPlayerID   uint       `json:"from_player_id"`
+	ToPlayerID     uint       `json:"to_player_id"`
+	OfferType      string     `json:"offer_type"` // Resource the proposer gives
+	OfferAmount    int        `json:"offer_amount"`
+	RequestType    string     `json:"request_type"` // Resource the proposer asks for in return
+	RequestAmount  int        `json:"request_amount"`
+	Status         string     `gorm:"type:enum('Pending','Accepted','Declined','Countered','Cancelled','Expired');default:'Pending'" json:"status"`
+	CounterOfID    uint       `json:"counter_of_id,omitempty"` // Offer this one counters
+	ExpiresAt      time.Time  `json:"expires_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+// MarketOrder is a player's order to buy or sell a resource for Gold on a game
+// instance's market. What the order could cost is held from the player until it is
+// filled or cancelled.
+type MarketOrder struct {
+	gorm.Model
+	GameInstanceID uint   `gorm:"index:idx_market_book" json:"game_instance_id"`
+	PlayerID       uint   `gorm:"index" json:"player_id"`
+	Side           string `gorm:"type:enum('Buy','Sell');not null" json:"side"`
+	Type           string `gorm:"index:idx_market_book" json:"type"`
+	Price          int    `json:"price"` // Gold per unit
+	Amount         int    `json:"amount"`
+	Remaining      int    `json:"remaining"` // Units not filled yet
+	Status         string `gorm:"type:enum('Open','Filled','Cancelled');default:'Open';index:idx_market_book" json:"status"`
+}
+
+// MarketTrade records a buy order and a sell order filling each other.
+type MarketTrade struct {
+	gorm.Model
+	GameInstanceID uint   `gorm:"index" json:"game_instance_id"`
+	Type           string `json:"type"`
+	Price          int    `json:"price"` // Gold per unit
+	Amount         int    `json:"amount"`
+	BuyOrderID     uint   `json:"buy_order_id"`
+	SellOrderID    uint   `json:"sell_order_id"`
+	BuyerID        uint   `json:"buyer_id"`
+	SellerID       uint   `json:"seller_id"`
+	BuyerFee       int    `json:"buyer_fee"`  // Units of the resource kept from the buyer
+	SellerFee      int    `json:"seller_fee"` // Gold kept from the seller
+}
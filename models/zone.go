@@ -9,8 +9,11 @@ import (
 // Zone represents a territory or control area within a game instance.
 type Zone struct {
 	gorm.Model
-	GameInstanceID        uint      `json:"game_instance_id"`
+	GameInstanceID        uint      `gorm:"uniqueIndex:idx_zone_position" json:"game_instance_id"`
+	X                     int       `gorm:"uniqueIndex:idx_zone_position" json:"x"`
+	Y                     int       `gorm:"uniqueIndex:idx_zone_position" json:"y"`
 	Coordinates           string    `json:"coordinates"` // e.g., "x,y"
 	ControlledByFactionID uint      `json:"controlled_by_faction_id,omitempty"`
+	Garrison              int       `json:"garrison"` // Units defending the zone
 	LastControlChange     time.Time `json:"last_control_change"`
 }
@@ -0,0 +1,74 @@
+// Package projects defines the buildings players can construct and the research they can
+// complete in a game instance, with what each costs and how long it takes.
+package projects
+
+import (
+	"math"
+	"time"
+
+	"drokkit/economy"
+)
+
+// Project kinds, matching the Project kind enum
+const (
+	Building = "Building"
+	Research = "Research"
+)
+
+// CancelRefundShare is the share of its cost given back when a project that has already
+// started is cancelled.
+const CancelRefundShare = 0.5
+
+// Blueprint describes a building or a piece of research.
+type Blueprint struct {
+	Name     string         `json:"name"`
+	Kind     string         `json:"kind"`
+	Cost     map[string]int `json:"cost"`     // Resources spent when the project is started
+	Duration int            `json:"duration"` // Seconds to complete, before speed bonuses
+}
+
+// Catalog lists every building and piece of research.
+var Catalog = []Blueprint{
+	{Name: "Farm", Kind: Building, Cost: map[string]int{economy.Wood: 50, economy.Stone: 20}, Duration: 60},
+	{Name: "Lumber Mill", Kind: Building, Cost: map[string]int{economy.Gold: 40, economy.Wood: 30}, Duration: 60},
+	{Name: "Quarry", Kind: Building, Cost: map[string]int{economy.Gold: 40, economy.Wood: 40}, Duration: 90},
+	{Name: "Barracks", Kind: Building, Cost: map[string]int{economy.Gold: 100, economy.Wood: 80, economy.Stone: 60}, Duration: 180},
+	{Name: "Walls", Kind: Building, Cost: map[string]int{economy.Gold: 50, economy.Stone: 150}, Duration: 240},
+	{Name: "Agriculture", Kind: Research, Cost: map[string]int{economy.Gold: 60, economy.Food: 40}, Duration: 120},
+	{Name: "Masonry", Kind: Research, Cost: map[string]int{economy.Gold: 80, economy.Stone: 30}, Duration: 150},
+	{Name: "Tactics", Kind: Research, Cost: map[string]int{economy.Gold: 120, economy.Food: 60}, Duration: 240},
+	{Name: "Trade Routes", Kind: Research, Cost: map[string]int{economy.Gold: 150}, Duration: 240},
+}
+
+// Lookup returns the blueprint with the given name.
+func Lookup(name string) (Blueprint, bool) {
+	for _, blueprint := range Catalog {
+		if blueprint.Name == name {
+			return blueprint, true
+		}
+	}
+	return Blueprint{}, false
+}
+
+// Duration returns how long a project takes for a player with the given speed bonus. A
+// speed of 1.5 finishes in two thirds of the time; players without a speed bonus take the
+// blueprint's duration.
+func Duration(blueprint Blueprint, speed float64) time.Duration {
+	if speed <= 0 {
+		speed = 1
+	}
+	return time.Duration(math.Round(float64(blueprint.Duration)/speed)) * time.Second
+}
+
+// Refund returns what is given back when a project is cancelled: all of its cost if it
+// has not started yet, otherwise CancelRefundShare of it, rounded down.
+func Refund(cost map[string]int, started bool) map[string]int {
+	refund := make(map[string]int, len(cost))
+	for resourceType, amount := range cost {
+		if started {
+			amount = int(float64(amount) * CancelRefundShare)
+		}
+		refund[resourceType] = amount
+	}
+	return refund
+}
@@ -0,0 +1,78 @@
+package projects
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"drokkit/economy"
+)
+
+func TestDuration(t *testing.T) {
+	blueprint := Blueprint{Name: "Test", Kind: Building, Duration: 90}
+	tests := []struct {
+		speed float64
+		want  time.Duration
+	}{
+		{1, 90 * time.Second},
+		{1.5, 60 * time.Second}, // Two thirds of the time
+		{2, 45 * time.Second},
+		{0.5, 180 * time.Second},
+		{0, 90 * time.Second},  // No speed bonus
+		{-1, 90 * time.Second}, // Treated as no speed bonus
+		{1.2, 75 * time.Second},
+		{1.3, 69 * time.Second}, // Rounded to the nearest second
+	}
+	for _, test := range tests {
+		if got := Duration(blueprint, test.speed); got != test.want {
+			t.Errorf("Duration at speed %v = %v, want %v", test.speed, got, test.want)
+		}
+	}
+}
+
+func TestRefund(t *testing.T) {
+	cost := map[string]int{economy.Gold: 100, economy.Wood: 45, economy.Stone: 1}
+
+	full := Refund(cost, false)
+	if !reflect.DeepEqual(full, cost) {
+		t.Errorf("Refund before starting = %v, want the whole cost %v", full, cost)
+	}
+
+	partial := Refund(cost, true)
+	want := map[string]int{economy.Gold: 50, economy.Wood: 22, economy.Stone: 0}
+	if !reflect.DeepEqual(partial, want) {
+		t.Errorf("Refund in progress = %v, want %v", partial, want)
+	}
+
+	// The cost itself is left alone
+	if cost[economy.Gold] != 100 {
+		t.Errorf("Refund changed the cost to %v", cost)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, blueprint := range Catalog {
+		if seen[blueprint.Name] {
+			t.Errorf("%s is in the catalog more than once", blueprint.Name)
+		}
+		seen[blueprint.Name] = true
+		if blueprint.Kind != Building && blueprint.Kind != Research {
+			t.Errorf("%s has unknown kind %q", blueprint.Name, blueprint.Kind)
+		}
+		if blueprint.Duration <= 0 {
+			t.Errorf("%s has duration %d", blueprint.Name, blueprint.Duration)
+		}
+		for resourceType, amount := range blueprint.Cost {
+			if _, ok := economy.Lookup(resourceType); !ok || amount <= 0 {
+				t.Errorf("%s costs %d of %q", blueprint.Name, amount, resourceType)
+			}
+		}
+		if found, ok := Lookup(blueprint.Name); !ok || found.Name != blueprint.Name {
+			t.Errorf("Lookup(%q) did not find it", blueprint.Name)
+		}
+	}
+	if _, ok := Lookup("Nope"); ok {
+		t.Error("Lookup found a project that does not exist")
+	}
+}
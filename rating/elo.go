@@ -0,0 +1,42 @@
+// Package rating implements the Elo rating system used to rank players.
+package rating
+
+import "math"
+
+// Initial is the rating given to a player before their first rated game.
+const Initial = 1200
+
+// Match results, from the point of view of the first player
+const (
+	Loss = 0.0
+	Draw = 0.5
+	Win  = 1.0
+)
+
+// Elo calculates rating changes using the Elo system.
+type Elo struct {
+	K float64 // Maximum rating change from a single game
+}
+
+// Default is the Elo configuration used for ranked matches.
+var Default = Elo{K: 32}
+
+// Expected returns the expected score of a player rated a against a player rated b.
+func Expected(a, b int) float64 {
+	return 1 / (1 + math.Pow(10, float64(b-a)/400))
+}
+
+// Delta returns the rating change of a player rated a after scoring against a player
+// rated b. The opponent's change is the negation, so ratings are zero-sum.
+func (e Elo) Delta(a, b int, score float64) int {
+	return int(math.Round(e.K * (score - Expected(a, b))))
+}
+
+// SeasonCarryOver is the share of a player's distance from Initial kept across a season reset.
+const SeasonCarryOver = 0.5
+
+// SoftReset pulls a rating towards Initial at the start of a new season, so players keep
+// part of their standing without carrying it over in full.
+func SoftReset(r int) int {
+	return Initial + int(math.Round(float64(r-Initial)*SeasonCarryOver))
+}
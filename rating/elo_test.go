@@ -0,0 +1,98 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpected(t *testing.T) {
+	if got := Expected(1500, 1500); got != 0.5 {
+		t.Errorf("Expected between equal ratings = %v, want 0.5", got)
+	}
+	// 400 points is ten to one odds
+	if got := Expected(1600, 1200); math.Abs(got-10.0/11) > 1e-9 {
+		t.Errorf("Expected(1600, 1200) = %v, want %v", got, 10.0/11)
+	}
+
+	pairs := [][2]int{{1200, 1200}, {1500, 1200}, {800, 2400}, {1234, 1987}}
+	for _, pair := range pairs {
+		a, b := pair[0], pair[1]
+		if sum := Expected(a, b) + Expected(b, a); math.Abs(sum-1) > 1e-9 {
+			t.Errorf("Expected(%d, %d) + Expected(%d, %d) = %v, want 1", a, b, b, a, sum)
+		}
+		if a > b && Expected(a, b) <= 0.5 {
+			t.Errorf("Expected(%d, %d) = %v, want the higher rated player favoured", a, b, Expected(a, b))
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  int
+		score float64
+		want  int
+	}{
+		{"win between equals", 1200, 1200, Win, 16},
+		{"loss between equals", 1200, 1200, Loss, -16},
+		{"draw between equals", 1200, 1200, Draw, 0},
+		{"upset win", 1200, 1600, Win, 29},
+		{"expected win", 1600, 1200, Win, 3},
+		{"draw against a stronger player", 1200, 1600, Draw, 13},
+	}
+	for _, test := range tests {
+		if got := Default.Delta(test.a, test.b, test.score); got != test.want {
+			t.Errorf("%s: Delta(%d, %d, %v) = %d, want %d", test.name, test.a, test.b, test.score, got, test.want)
+		}
+	}
+}
+
+func TestDeltaIsZeroSum(t *testing.T) {
+	ratings := []int{800, 1150, 1200, 1201, 1480, 2100}
+	for _, elo := range []Elo{Default, {K: 16}, {K: 40}} {
+		for _, a := range ratings {
+			for _, b := range ratings {
+				for _, score := range []float64{Win, Draw, Loss} {
+					gained := elo.Delta(a, b, score)
+					lost := elo.Delta(b, a, 1-score)
+					if gained+lost != 0 {
+						t.Errorf("K=%v: %d vs %d scoring %v changes ratings by %d and %d, want zero-sum", elo.K, a, b, score, gained, lost)
+					}
+					if gained < -int(elo.K) || gained > int(elo.K) {
+						t.Errorf("K=%v: Delta(%d, %d, %v) = %d, more than K", elo.K, a, b, score, gained)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSoftReset(t *testing.T) {
+	tests := []struct {
+		rating, want int
+	}{
+		{Initial, Initial},
+		{1600, 1400},
+		{800, 1000},
+		{1201, 1201}, // Half a point rounds away from Initial
+		{1199, 1199},
+		{2400, 1800},
+	}
+	for _, test := range tests {
+		got := SoftReset(test.rating)
+		if got != test.want {
+			t.Errorf("SoftReset(%d) = %d, want %d", test.rating, got, test.want)
+		}
+		// The reset never moves a rating past Initial or further from it
+		if distance, before := abs(got-Initial), abs(test.rating-Initial); distance > before || (test.rating-Initial)*(got-Initial) < 0 {
+			t.Errorf("SoftReset(%d) = %d, which does not pull towards %d", test.rating, got, Initial)
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
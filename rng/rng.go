@@ -0,0 +1,100 @@
+// Package rng generates the deterministic random numbers that decide game outcomes.
+//
+// Every game instance has a secret seed. The nth draw of an instance is derived from the
+// seed and n alone, so the same seed always produces the same sequence of draws and a
+// game can be replayed exactly, even across server restarts.
+package rng
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// seedSize is the number of random bytes in a seed.
+const seedSize = 32
+
+// ErrInvalidSeed is returned for a seed that was not produced by NewSeed.
+var ErrInvalidSeed = errors.New("rng: invalid seed")
+
+// NewSeed returns a new random seed, hex encoded.
+func NewSeed() (string, error) {
+	seed := make([]byte, seedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(seed), nil
+}
+
+// Source produces the draws for one seed, in order.
+type Source struct {
+	seed []byte
+	next uint64
+}
+
+// New returns a source for the seed, positioned so its next draw has the given sequence
+// number. Use the number of draws already made to continue an earlier source.
+func New(seed string, next uint64) (*Source, error) {
+	key, err := hex.DecodeString(seed)
+	if err != nil || len(key) != seedSize {
+		return nil, ErrInvalidSeed
+	}
+	return &Source{seed: key, next: next}, nil
+}
+
+// Next returns the sequence number of the next draw.
+func (s *Source) Next() uint64 {
+	return s.next
+}
+
+// Uint64 returns the next raw 64-bit value.
+func (s *Source) Uint64() uint64 {
+	mac := hmac.New(sha256.New, s.seed)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], s.next)
+	mac.Write(counter[:])
+	s.next++
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// Intn returns the next draw as a number in [0, n). It panics if n <= 0.
+func (s *Source) Intn(n int) int {
+	if n <= 0 {
+		panic("rng: invalid argument to Intn")
+	}
+	// Scaling a 64-bit value keeps each draw to a single raw value; the bias is at most
+	// n/2^64, far below anything a game could notice.
+	hi, _ := bits.Mul64(s.Uint64(), uint64(n))
+	return int(hi)
+}
+
+// Draw is a recorded draw: the sequence number it was made at, the bound it was drawn
+// below and the value that came out.
+type Draw struct {
+	Sequence uint64
+	Bound    int
+	Value    int
+}
+
+// Replay checks that every draw is the one the seed produces at its sequence number.
+func Replay(seed string, draws []Draw) error {
+	source, err := New(seed, 0)
+	if err != nil {
+		return err
+	}
+	for _, draw := range draws {
+		if draw.Bound <= 0 {
+			return fmt.Errorf("rng: draw %d has invalid bound %d", draw.Sequence, draw.Bound)
+		}
+		source.next = draw.Sequence
+		if value := source.Intn(draw.Bound); value != draw.Value {
+			return fmt.Errorf("rng: draw %d is %d, seed gives %d", draw.Sequence, draw.Value, value)
+		}
+	}
+	return nil
+}
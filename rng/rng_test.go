@@ -0,0 +1,122 @@
+package rng
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestSource(t *testing.T, seed string, next uint64) *Source {
+	t.Helper()
+	source, err := New(seed, next)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return source
+}
+
+func TestSameSeedSameSequence(t *testing.T) {
+	seed, err := NewSeed()
+	if err != nil {
+		t.Fatalf("NewSeed: %v", err)
+	}
+	a := newTestSource(t, seed, 0)
+	b := newTestSource(t, seed, 0)
+	values := make([]uint64, 20)
+	for i := range values {
+		values[i] = a.Uint64()
+		if got := b.Uint64(); got != values[i] {
+			t.Fatalf("draw %d: sources with the same seed gave %d and %d", i, values[i], got)
+		}
+	}
+
+	// A source started part way through continues the same sequence
+	c := newTestSource(t, seed, 12)
+	for i := 12; i < len(values); i++ {
+		if got := c.Uint64(); got != values[i] {
+			t.Errorf("draw %d: source started at 12 gave %d, want %d", i, got, values[i])
+		}
+	}
+	if c.Next() != uint64(len(values)) {
+		t.Errorf("Next() = %d, want %d", c.Next(), len(values))
+	}
+
+	other, err := NewSeed()
+	if err != nil {
+		t.Fatalf("NewSeed: %v", err)
+	}
+	if newTestSource(t, other, 0).Uint64() == values[0] {
+		t.Error("different seeds gave the same first draw")
+	}
+}
+
+func TestNewRejectsInvalidSeed(t *testing.T) {
+	for _, seed := range []string{"", "not hex", "abcd", strings.Repeat("ab", seedSize+1)} {
+		if _, err := New(seed, 0); err != ErrInvalidSeed {
+			t.Errorf("New(%q) error = %v, want ErrInvalidSeed", seed, err)
+		}
+	}
+}
+
+func TestIntnInRange(t *testing.T) {
+	source := newTestSource(t, strings.Repeat("01", seedSize), 0)
+	for _, n := range []int{1, 2, 6, 20, 1000} {
+		seen := make(map[int]bool)
+		for i := 0; i < 500; i++ {
+			value := source.Intn(n)
+			if value < 0 || value >= n {
+				t.Fatalf("Intn(%d) = %d, out of range", n, value)
+			}
+			seen[value] = true
+		}
+		if n <= 20 && len(seen) != n {
+			t.Errorf("Intn(%d) gave only %d distinct values in 500 draws", n, len(seen))
+		}
+	}
+}
+
+func TestIntnRejectsInvalidBound(t *testing.T) {
+	source := newTestSource(t, strings.Repeat("01", seedSize), 0)
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Intn(%d) did not panic", n)
+				}
+			}()
+			source.Intn(n)
+		}()
+	}
+}
+
+func TestReplay(t *testing.T) {
+	seed := strings.Repeat("2a", seedSize)
+	source := newTestSource(t, seed, 0)
+	var draws []Draw
+	for _, bound := range []int{20, 20, 6, 100, 2} {
+		draws = append(draws, Draw{Sequence: source.Next(), Bound: bound, Value: source.Intn(bound)})
+	}
+
+	if err := Replay(seed, draws); err != nil {
+		t.Errorf("Replay of recorded draws: %v", err)
+	}
+	// Draws can be checked on their own, in any order
+	if err := Replay(seed, []Draw{draws[3], draws[1]}); err != nil {
+		t.Errorf("Replay of a subset of draws: %v", err)
+	}
+
+	tampered := append([]Draw(nil), draws...)
+	tampered[2].Value = (tampered[2].Value + 1) % tampered[2].Bound
+	if err := Replay(seed, tampered); err == nil {
+		t.Error("Replay accepted a tampered draw")
+	}
+
+	invalid := append([]Draw(nil), draws...)
+	invalid[0].Bound = 0
+	if err := Replay(seed, invalid); err == nil {
+		t.Error("Replay accepted a draw with an invalid bound")
+	}
+
+	if err := Replay(strings.Repeat("2b", seedSize), draws); err == nil {
+		t.Error("Replay accepted draws made with a different seed")
+	}
+}
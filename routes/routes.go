@@ -2,30 +2,60 @@ package routes
 
 import (
 	"drokkit/handlers"
-	"github.com/golang-jwt/jwt/v4"
+	"drokkit/models"
 	"github.com/gorilla/mux"
 	"net/http"
 )
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenCookie, err := r.Cookie("token")
-		if err != nil {
+		tokenStr := handlers.TokenFromRequest(r)
+		if tokenStr == "" {
 			http.Error(w, "Missing token", http.StatusUnauthorized)
 			return
 		}
 
-		tokenStr := tokenCookie.Value
-		claims := &handlers.Claims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return handlers.JwtKey, nil
-		})
+		claims, err := handlers.ParseToken(tokenStr)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
 
-		if err != nil || !token.Valid {
+		// Make the authenticated player available to handlers
+		ctx, err := handlers.WithAuthenticatedPlayer(r.Context(), claims)
+		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AdminMiddleware only lets through authenticated players that have an admin record.
+// It must run after AuthMiddleware.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := handlers.WithAdmin(r.Context())
+		if err != nil {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequirePermission wraps a handler so it only runs for admins holding the permission.
+// It must run after AdminMiddleware.
+func RequirePermission(permission models.Permission, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := handlers.AdminFromContext(r.Context())
+		if !ok || !admin.Permissions.Has(permission) {
+			http.Error(w, "Missing permission: "+string(permission), http.StatusForbidden)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -35,22 +65,90 @@ func InitRoutes() *mux.Router {
 
 	router.HandleFunc("/register", handlers.RegisterPlayer).Methods("POST")
 	router.HandleFunc("/login", handlers.LoginPlayer).Methods("POST")
+	router.HandleFunc("/refresh", handlers.RefreshToken).Methods("POST")
+	router.Handle("/logout", AuthMiddleware(http.HandlerFunc(handlers.LogoutPlayer))).Methods("POST")
 
 	protected := router.PathPrefix("/api").Subrouter()
 	protected.Use(AuthMiddleware)
 	protected.HandleFunc("/match", handlers.CreateMatch).Methods("POST")
+	protected.HandleFunc("/match/{id}/turn", handlers.PlayTurn).Methods("POST")
+	protected.HandleFunc("/match/{id}/abandon", handlers.AbandonMatch).Methods("POST")
+	protected.HandleFunc("/matchmaking", handlers.JoinQueue).Methods("POST")
+	protected.HandleFunc("/matchmaking", handlers.GetQueueStatus).Methods("GET")
+	protected.HandleFunc("/matchmaking", handlers.LeaveQueue).Methods("DELETE")
+	protected.HandleFunc("/instances", handlers.CreateInstance).Methods("POST")
+	protected.HandleFunc("/instances", handlers.ListInstances).Methods("GET")
+	protected.HandleFunc("/instances/{id}", handlers.GetInstance).Methods("GET")
+	protected.HandleFunc("/instances/{id}/join", handlers.JoinInstance).Methods("POST")
+	protected.HandleFunc("/instances/{id}/start", handlers.StartInstance).Methods("POST")
+	protected.HandleFunc("/instances/{id}/complete", handlers.CompleteInstance).Methods("POST")
+	protected.HandleFunc("/instances/{id}/victory-conditions", handlers.AddVictoryCondition).Methods("POST")
+	protected.HandleFunc("/instances/{id}/victory-conditions", handlers.ListVictoryConditions).Methods("GET")
+	protected.HandleFunc("/instances/{id}/draws", handlers.GetInstanceDraws).Methods("GET")
+	protected.HandleFunc("/instances/{id}/combat", handlers.ListCombatLogs).Methods("GET")
+	protected.HandleFunc("/instances/{id}/zones", handlers.GetZoneMap).Methods("GET")
+	protected.HandleFunc("/instances/{id}/resources", handlers.GetResources).Methods("GET")
+	protected.HandleFunc("/instances/{id}/ledger", handlers.GetResourceLedger).Methods("GET")
+	protected.HandleFunc("/instances/{id}/trades", handlers.ListTrades).Methods("GET")
+	protected.HandleFunc("/instances/{id}/market", handlers.GetOrderBook).Methods("GET")
+	protected.HandleFunc("/instances/{id}/market/orders", handlers.ListMarketOrders).Methods("GET")
+	protected.HandleFunc("/instances/{id}/market/trades", handlers.ListMarketTrades).Methods("GET")
+	protected.HandleFunc("/instances/{id}/projects", handlers.ListProjects).Methods("GET")
+	protected.HandleFunc("/zones/{id}", handlers.GetZone).Methods("GET")
+	protected.HandleFunc("/zones/{id}/garrison", handlers.GarrisonZone).Methods("POST")
+	protected.HandleFunc("/lobbies", handlers.CreateLobby).Methods("POST")
+	protected.HandleFunc("/lobbies", handlers.ListLobbies).Methods("GET")
+	protected.HandleFunc("/lobbies/join", handlers.JoinLobbyByCode).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}", handlers.GetLobby).Methods("GET")
+	protected.HandleFunc("/lobbies/{id}/join", handlers.JoinLobby).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}/leave", handlers.LeaveLobby).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}/kick", handlers.KickFromLobby).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}/host", handlers.TransferLobbyHost).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}/settings", handlers.UpdateLobbySettings).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}/ready", handlers.SetLobbyReady).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}/chat", handlers.SendLobbyChat).Methods("POST")
+	protected.HandleFunc("/lobbies/{id}/chat", handlers.GetLobbyChat).Methods("GET")
+	protected.HandleFunc("/lobbies/{id}/start", handlers.StartLobby).Methods("POST")
 	protected.HandleFunc("/faction", handlers.CreateFaction).Methods("POST")
+	protected.HandleFunc("/faction/types", handlers.ListFactionTypes).Methods("GET")
 	protected.HandleFunc("/alliance", handlers.CreateAlliance).Methods("POST")
-	protected.HandleFunc("/resource", handlers.UpdateResource).Methods("POST")
+	protected.HandleFunc("/resource/catalog", handlers.GetResourceCatalog).Methods("GET")
+	protected.HandleFunc("/resource/spend", handlers.SpendResource).Methods("POST")
+	protected.HandleFunc("/resource/transfer", handlers.TransferResource).Methods("POST")
+	protected.HandleFunc("/trades", handlers.ProposeTrade).Methods("POST")
+	protected.HandleFunc("/trades/{id}", handlers.GetTrade).Methods("GET")
+	protected.HandleFunc("/trades/{id}/counter", handlers.CounterTrade).Methods("POST")
+	protected.HandleFunc("/trades/{id}/accept", handlers.AcceptTrade).Methods("POST")
+	protected.HandleFunc("/trades/{id}/decline", handlers.DeclineTrade).Methods("POST")
+	protected.HandleFunc("/trades/{id}/cancel", handlers.CancelTrade).Methods("POST")
+	protected.HandleFunc("/market/orders", handlers.PlaceMarketOrder).Methods("POST")
+	protected.HandleFunc("/market/orders/{id}", handlers.CancelMarketOrder).Methods("DELETE")
+	protected.HandleFunc("/projects/catalog", handlers.GetProjectCatalog).Methods("GET")
+	protected.HandleFunc("/projects", handlers.StartProject).Methods("POST")
+	protected.HandleFunc("/projects/{id}/cancel", handlers.CancelProject).Methods("POST")
+	protected.HandleFunc("/combat", handlers.Attack).Methods("POST")
+	protected.HandleFunc("/combat/{id}", handlers.GetCombatLog).Methods("GET")
 
 	router.HandleFunc("/ws/play", handlers.WebSocketHandler).Methods("GET")
 
 	admin := router.PathPrefix("/admin").Subrouter()
-	admin.Use(AuthMiddleware)
-	admin.HandleFunc("/create", handlers.CreateAdmin).Methods("POST")
-	admin.HandleFunc("/delete-player", handlers.DeletePlayer).Methods("DELETE")
+	admin.Use(AuthMiddleware, AdminMiddleware)
+	admin.Handle("/create", RequirePermission(models.PermissionManageAdmins, handlers.CreateAdmin)).Methods("POST")
+	admin.Handle("/delete-player", RequirePermission(models.PermissionManagePlayers, handlers.DeletePlayer)).Methods("DELETE")
+	admin.Handle("/leaderboard/rebuild", RequirePermission(models.PermissionManageGames, handlers.RebuildLeaderboards)).Methods("POST")
+	admin.Handle("/seasons", RequirePermission(models.PermissionManageGames, handlers.CreateSeason)).Methods("POST")
+	admin.Handle("/seasons/{id}/end", RequirePermission(models.PermissionManageGames, handlers.EndSeason)).Methods("POST")
+	admin.Handle("/instances/{id}/draws", RequirePermission(models.PermissionManageGames, handlers.GetInstanceDraws)).Methods("GET")
+	admin.Handle("/factions/types", RequirePermission(models.PermissionManageGames, handlers.ListFactionTypes)).Methods("GET")
+	admin.Handle("/factions/types", RequirePermission(models.PermissionManageGames, handlers.ReplaceFactionTypes)).Methods("PUT")
+	admin.Handle("/factions/types/reload", RequirePermission(models.PermissionManageGames, handlers.ReloadFactionTypes)).Methods("POST")
+	admin.Handle("/resource/grant", RequirePermission(models.PermissionManageGames, handlers.GrantResource)).Methods("POST")
 
 	router.HandleFunc("/leaderboard", handlers.GetLeaderboard).Methods("GET")
+	router.HandleFunc("/leaderboard/player/{id}", handlers.GetPlayerRank).Methods("GET")
+	router.HandleFunc("/seasons", handlers.ListSeasons).Methods("GET")
+	router.HandleFunc("/seasons/{id}", handlers.GetSeason).Methods("GET")
+	router.HandleFunc("/seasons/{id}/stats", handlers.GetSeasonStats).Methods("GET")
 
 	return router
 }
@@ -0,0 +1,38 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// FreeForm accepts any non-empty action and never ends on its own. It keeps the
+// behaviour matches had before rulesets existed, leaving validation to the client.
+type FreeForm struct{}
+
+// NewState returns an empty state.
+func (FreeForm) NewState(players []uint) (json.RawMessage, error) {
+	return json.RawMessage("{}"), nil
+}
+
+// ValidateMove only requires the action to be present.
+func (FreeForm) ValidateMove(state json.RawMessage, playerID uint, move Move) error {
+	if move.Action == "" {
+		return errors.New("action is required")
+	}
+	return nil
+}
+
+// ApplyMove leaves the state unchanged; moves are recorded in the match history.
+func (FreeForm) ApplyMove(state json.RawMessage, playerID uint, move Move) (json.RawMessage, error) {
+	return state, nil
+}
+
+// Result never reports the game as over.
+func (FreeForm) Result(state json.RawMessage) (Result, error) {
+	return Result{}, nil
+}
+
+// PlayerView shows the whole state to every player.
+func (FreeForm) PlayerView(state json.RawMessage, playerID uint) (json.RawMessage, error) {
+	return state, nil
+}
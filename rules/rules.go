@@ -0,0 +1,86 @@
+// Package rules defines the game rules engine used to validate and apply moves in a match.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Move is a single move submitted by a player.
+type Move struct {
+	Action  string          `json:"action"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Result reports whether a game has ended and who won it.
+type Result struct {
+	Over     bool `json:"over"`
+	WinnerID uint `json:"winner_id,omitempty"` // Zero when the game ended in a draw
+}
+
+// RuleSet implements the rules for one game type. State is passed around as the
+// ruleset's own JSON encoding so it can be stored as part of the match game state.
+type RuleSet interface {
+	// NewState returns the initial state for a game between the given players, in turn order.
+	NewState(players []uint) (json.RawMessage, error)
+	// ValidateMove returns an error describing why the player may not make the move.
+	ValidateMove(state json.RawMessage, playerID uint, move Move) error
+	// ApplyMove returns the state after the move has been made. The move must already be valid.
+	ApplyMove(state json.RawMessage, playerID uint, move Move) (json.RawMessage, error)
+	// Result reports whether the game in the given state has ended.
+	Result(state json.RawMessage) (Result, error)
+	// PlayerView returns the state as the given player is allowed to see it.
+	PlayerView(state json.RawMessage, playerID uint) (json.RawMessage, error)
+}
+
+// DefaultGameType is used for matches that do not request a game type.
+const DefaultGameType = "freeform"
+
+var (
+	registry   = make(map[string]RuleSet)
+	registryMu sync.RWMutex
+)
+
+func init() {
+	Register(DefaultGameType, FreeForm{})
+	Register("tictactoe", TicTacToe{})
+}
+
+// Register makes a ruleset available under the given game type name.
+// Registering the same name twice replaces the earlier ruleset.
+func Register(gameType string, rs RuleSet) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[gameType] = rs
+}
+
+// Get looks up the ruleset for a game type.
+func Get(gameType string) (RuleSet, error) {
+	if gameType == "" {
+		gameType = DefaultGameType
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	rs, ok := registry[gameType]
+	if !ok {
+		return nil, fmt.Errorf("unknown game type %q", gameType)
+	}
+	return rs, nil
+}
+
+// GameTypes returns the names of all registered game types.
+func GameTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
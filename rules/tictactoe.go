@@ -0,0 +1,114 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// TicTacToe is a two player game on a 3x3 grid. A move's action is the index of
+// the cell to mark, 0-8, counted left to right and top to bottom.
+type TicTacToe struct{}
+
+// ticTacToeState is the stored state of a tic-tac-toe game.
+type ticTacToeState struct {
+	Players [2]uint `json:"players"`
+	Board   [9]uint `json:"board"` // Player ID owning each cell, zero when empty
+	Next    int     `json:"next"`  // Index into Players of the player to move
+}
+
+var ticTacToeLines = [8][3]int{
+	{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
+	{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
+	{0, 4, 8}, {2, 4, 6},
+}
+
+// NewState creates an empty board with the first player to move.
+func (TicTacToe) NewState(players []uint) (json.RawMessage, error) {
+	if len(players) != 2 {
+		return nil, errors.New("tic-tac-toe requires exactly two players")
+	}
+	if players[0] == players[1] {
+		return nil, errors.New("tic-tac-toe requires two different players")
+	}
+	return json.Marshal(ticTacToeState{Players: [2]uint{players[0], players[1]}})
+}
+
+// ValidateMove checks it is the player's turn and the target cell is free.
+func (t TicTacToe) ValidateMove(state json.RawMessage, playerID uint, move Move) error {
+	s, err := decodeTicTacToe(state)
+	if err != nil {
+		return err
+	}
+	if over, _ := s.result(); over {
+		return errors.New("game is over")
+	}
+	if s.Players[s.Next] != playerID {
+		return errors.New("not your turn")
+	}
+
+	cell, err := strconv.Atoi(move.Action)
+	if err != nil || cell < 0 || cell > 8 {
+		return fmt.Errorf("invalid cell %q", move.Action)
+	}
+	if s.Board[cell] != 0 {
+		return fmt.Errorf("cell %d is already taken", cell)
+	}
+	return nil
+}
+
+// ApplyMove marks the cell and passes the turn to the other player.
+func (t TicTacToe) ApplyMove(state json.RawMessage, playerID uint, move Move) (json.RawMessage, error) {
+	if err := t.ValidateMove(state, playerID, move); err != nil {
+		return nil, err
+	}
+
+	s, err := decodeTicTacToe(state)
+	if err != nil {
+		return nil, err
+	}
+	cell, _ := strconv.Atoi(move.Action)
+	s.Board[cell] = playerID
+	s.Next = 1 - s.Next
+
+	return json.Marshal(s)
+}
+
+// Result reports a win for three in a row, or a draw once the board is full.
+func (TicTacToe) Result(state json.RawMessage) (Result, error) {
+	s, err := decodeTicTacToe(state)
+	if err != nil {
+		return Result{}, err
+	}
+	over, winner := s.result()
+	return Result{Over: over, WinnerID: winner}, nil
+}
+
+// PlayerView shows the whole board; tic-tac-toe has no hidden information.
+func (TicTacToe) PlayerView(state json.RawMessage, playerID uint) (json.RawMessage, error) {
+	return state, nil
+}
+
+func decodeTicTacToe(state json.RawMessage) (ticTacToeState, error) {
+	var s ticTacToeState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return s, fmt.Errorf("invalid tic-tac-toe state: %w", err)
+	}
+	return s, nil
+}
+
+func (s ticTacToeState) result() (over bool, winner uint) {
+	for _, line := range ticTacToeLines {
+		a, b, c := s.Board[line[0]], s.Board[line[1]], s.Board[line[2]]
+		if a != 0 && a == b && b == c {
+			return true, a
+		}
+	}
+	for _, cell := range s.Board {
+		if cell == 0 {
+			return false, 0
+		}
+	}
+	return true, 0
+}
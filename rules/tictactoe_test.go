@@ -0,0 +1,122 @@
+package rules
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// playTicTacToe starts a game between players 1 and 2 and makes the given moves in turn,
+// failing the test if any of them is rejected.
+func playTicTacToe(t *testing.T, cells ...int) json.RawMessage {
+	t.Helper()
+	var game TicTacToe
+	state, err := game.NewState([]uint{1, 2})
+	if err != nil {
+		t.Fatalf("NewState: %v", err)
+	}
+	players := []uint{1, 2}
+	for i, cell := range cells {
+		state, err = game.ApplyMove(state, players[i%2], Move{Action: strconv.Itoa(cell)})
+		if err != nil {
+			t.Fatalf("move %d at cell %d: %v", i+1, cell, err)
+		}
+	}
+	return state
+}
+
+func TestTicTacToeResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		cells  []int
+		over   bool
+		winner uint
+	}{
+		{"in progress", []int{0, 4, 8}, false, 0},
+		{"row", []int{0, 3, 1, 4, 2}, true, 1},
+		{"column", []int{0, 1, 3, 4, 8, 7}, true, 2},
+		{"diagonal", []int{0, 1, 4, 2, 8}, true, 1},
+		{"anti-diagonal", []int{2, 0, 4, 1, 6}, true, 1},
+		{"draw", []int{0, 1, 2, 4, 3, 5, 7, 6, 8}, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := playTicTacToe(t, test.cells...)
+			result, err := TicTacToe{}.Result(state)
+			if err != nil {
+				t.Fatalf("Result: %v", err)
+			}
+			if result.Over != test.over || result.WinnerID != test.winner {
+				t.Errorf("Result = %+v, want over %v with winner %d", result, test.over, test.winner)
+			}
+		})
+	}
+}
+
+func TestTicTacToeValidateMove(t *testing.T) {
+	tests := []struct {
+		name   string
+		cells  []int
+		player uint
+		action string
+	}{
+		{"occupied cell", []int{4}, 2, "4"},
+		{"cell below range", nil, 1, "-1"},
+		{"cell above range", nil, 1, "9"},
+		{"not a cell", nil, 1, "centre"},
+		{"out of turn", nil, 2, "0"},
+		{"out of turn after a move", []int{0}, 1, "1"},
+		{"not a player", nil, 3, "0"},
+		{"game over", []int{0, 3, 1, 4, 2}, 2, "5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := playTicTacToe(t, test.cells...)
+			move := Move{Action: test.action}
+			if err := (TicTacToe{}).ValidateMove(state, test.player, move); err == nil {
+				t.Errorf("ValidateMove(%d, %q) accepted an invalid move", test.player, test.action)
+			}
+			if _, err := (TicTacToe{}).ApplyMove(state, test.player, move); err == nil {
+				t.Errorf("ApplyMove(%d, %q) applied an invalid move", test.player, test.action)
+			}
+		})
+	}
+}
+
+func TestTicTacToeNewState(t *testing.T) {
+	for _, players := range [][]uint{nil, {1}, {1, 1}, {1, 2, 3}} {
+		if _, err := (TicTacToe{}).NewState(players); err == nil {
+			t.Errorf("NewState(%v) accepted an invalid set of players", players)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	Register("test-freeform", FreeForm{})
+
+	rs, err := Get("test-freeform")
+	if err != nil {
+		t.Fatalf("Get registered ruleset: %v", err)
+	}
+	if _, ok := rs.(FreeForm); !ok {
+		t.Errorf("Get returned %T, want FreeForm", rs)
+	}
+
+	found := false
+	for _, name := range GameTypes() {
+		found = found || name == "test-freeform"
+	}
+	if !found {
+		t.Errorf("GameTypes() = %v, missing test-freeform", GameTypes())
+	}
+
+	if rs, err := Get(""); err != nil {
+		t.Errorf("Get default ruleset: %v", err)
+	} else if _, ok := rs.(FreeForm); !ok {
+		t.Errorf("Get(\"\") returned %T, want the default FreeForm", rs)
+	}
+
+	if _, err := Get("no-such-game"); err == nil {
+		t.Error("Get accepted an unknown game type")
+	}
+}
@@ -0,0 +1,98 @@
+package sessions
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryPruneInterval is how often saving a refresh token also drops expired entries.
+const memoryPruneInterval = time.Minute
+
+// MemoryStore keeps sessions in process memory. It is meant for tests and
+// single-instance development servers; everything is lost on restart.
+type MemoryStore struct {
+	mu            sync.Mutex
+	refreshTokens map[string]Session
+	revoked       map[string]time.Time
+	pruned        time.Time        // When expired entries were last dropped
+	now           func() time.Time // Swapped for a fake in tests
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		refreshTokens: make(map[string]Session),
+		revoked:       make(map[string]time.Time),
+		now:           time.Now,
+	}
+}
+
+// SaveRefreshToken stores the session a refresh token belongs to. Expired refresh tokens
+// and revocations are dropped at most once every memoryPruneInterval, so tokens that are
+// never used do not pile up.
+func (s *MemoryStore) SaveRefreshToken(token string, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := s.now(); now.Sub(s.pruned) >= memoryPruneInterval {
+		s.prune(now)
+		s.pruned = now
+	}
+	s.refreshTokens[hashToken(token)] = session
+	return nil
+}
+
+// prune drops every refresh token and revocation that has expired. The caller must hold s.mu.
+func (s *MemoryStore) prune(now time.Time) {
+	for key, session := range s.refreshTokens {
+		if !session.ExpiresAt.After(now) {
+			delete(s.refreshTokens, key)
+		}
+	}
+	for sessionID, until := range s.revoked {
+		if !until.After(now) {
+			delete(s.revoked, sessionID)
+		}
+	}
+}
+
+// ConsumeRefreshToken removes a refresh token and returns its session.
+func (s *MemoryStore) ConsumeRefreshToken(token string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashToken(token)
+	session, ok := s.refreshTokens[key]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	delete(s.refreshTokens, key)
+
+	if !session.ExpiresAt.After(s.now()) {
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+// Revoke marks a session as revoked until the given time.
+func (s *MemoryStore) Revoke(sessionID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[sessionID] = until
+	return nil
+}
+
+// IsRevoked reports whether a session has been revoked.
+func (s *MemoryStore) IsRevoked(sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.revoked[sessionID]
+	if !ok {
+		return false, nil
+	}
+	if !until.After(s.now()) {
+		delete(s.revoked, sessionID)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,150 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestStore returns a memory store whose clock is controlled by the returned function.
+func newTestStore() (*MemoryStore, func(time.Duration)) {
+	store := NewMemoryStore()
+	now := testStart
+	store.now = func() time.Time { return now }
+	return store, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRefreshTokens(t *testing.T) {
+	session := Session{ID: "session-1", PlayerID: 7, Username: "alice", ExpiresAt: testStart.Add(time.Hour)}
+
+	// Each step acts on the store in turn; the store and clock carry over between steps
+	type step struct {
+		action  string // "save", "consume" or "advance"
+		token   string
+		advance time.Duration
+		wantOK  bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"consumed once", []step{
+			{action: "save", token: "a"},
+			{action: "consume", token: "a", wantOK: true},
+			{action: "consume", token: "a", wantOK: false},
+		}},
+		{"rotation keeps the session", []step{
+			{action: "save", token: "a"},
+			{action: "consume", token: "a", wantOK: true},
+			{action: "save", token: "b"},
+			{action: "consume", token: "a", wantOK: false},
+			{action: "consume", token: "b", wantOK: true},
+		}},
+		{"unknown token", []step{
+			{action: "save", token: "a"},
+			{action: "consume", token: "b", wantOK: false},
+			{action: "consume", token: "a", wantOK: true},
+		}},
+		{"usable until the session expires", []step{
+			{action: "save", token: "a"},
+			{action: "advance", advance: time.Hour - time.Second},
+			{action: "consume", token: "a", wantOK: true},
+		}},
+		{"expired", []step{
+			{action: "save", token: "a"},
+			{action: "advance", advance: time.Hour},
+			{action: "consume", token: "a", wantOK: false},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, advance := newTestStore()
+			for i, step := range test.steps {
+				switch step.action {
+				case "save":
+					if err := store.SaveRefreshToken(step.token, session); err != nil {
+						t.Fatalf("step %d: SaveRefreshToken: %v", i+1, err)
+					}
+				case "advance":
+					advance(step.advance)
+				case "consume":
+					got, err := store.ConsumeRefreshToken(step.token)
+					if step.wantOK && (err != nil || got != session) {
+						t.Errorf("step %d: ConsumeRefreshToken(%q) = %+v, %v, want the session", i+1, step.token, got, err)
+					}
+					if !step.wantOK && err != ErrNotFound {
+						t.Errorf("step %d: ConsumeRefreshToken(%q) error = %v, want ErrNotFound", i+1, step.token, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRefreshTokensAreHashed(t *testing.T) {
+	store, _ := newTestStore()
+	store.SaveRefreshToken("secret-token", Session{ID: "session-1", ExpiresAt: testStart.Add(time.Hour)})
+	if _, ok := store.refreshTokens["secret-token"]; ok {
+		t.Error("refresh token is stored in plain text")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	tests := []struct {
+		name    string
+		until   time.Duration // Revoked until this long after the start; zero means never revoked
+		advance time.Duration
+		revoked bool
+	}{
+		{"not revoked", 0, 0, false},
+		{"revoked", time.Hour, 0, true},
+		{"revoked until just after now", time.Hour, time.Hour - time.Second, true},
+		{"revocation expired", time.Hour, time.Hour, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, advance := newTestStore()
+			if test.until != 0 {
+				if err := store.Revoke("session-1", testStart.Add(test.until)); err != nil {
+					t.Fatalf("Revoke: %v", err)
+				}
+			}
+			advance(test.advance)
+			revoked, err := store.IsRevoked("session-1")
+			if err != nil || revoked != test.revoked {
+				t.Errorf("IsRevoked = %v, %v, want %v", revoked, err, test.revoked)
+			}
+			if revoked, _ := store.IsRevoked("session-2"); revoked {
+				t.Error("revoking one session revoked another")
+			}
+		})
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	store, advance := newTestStore()
+	store.SaveRefreshToken("short", Session{ID: "session-1", ExpiresAt: testStart.Add(time.Minute)})
+	store.SaveRefreshToken("long", Session{ID: "session-2", ExpiresAt: testStart.Add(time.Hour)})
+	store.Revoke("session-1", testStart.Add(time.Minute))
+	store.Revoke("session-2", testStart.Add(time.Hour))
+
+	// Saving drops expired entries, but no more than once every memoryPruneInterval
+	advance(memoryPruneInterval - time.Second)
+	store.SaveRefreshToken("other", Session{ID: "session-3", ExpiresAt: testStart.Add(time.Hour)})
+	if len(store.refreshTokens) != 3 {
+		t.Errorf("%d refresh tokens held before pruning is due, want 3", len(store.refreshTokens))
+	}
+
+	advance(time.Second)
+	store.SaveRefreshToken("newest", Session{ID: "session-4", ExpiresAt: testStart.Add(time.Hour)})
+	if len(store.refreshTokens) != 3 || len(store.revoked) != 1 {
+		t.Errorf("%d refresh tokens and %d revocations held after pruning, want 3 and 1", len(store.refreshTokens), len(store.revoked))
+	}
+	if _, err := store.ConsumeRefreshToken("long"); err != nil {
+		t.Errorf("unexpired refresh token was pruned: %v", err)
+	}
+	if revoked, _ := store.IsRevoked("session-2"); !revoked {
+		t.Error("unexpired revocation was pruned")
+	}
+}
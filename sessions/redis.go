@@ -0,0 +1,73 @@
+package sessions
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	refreshKeyPrefix = "session:refresh:"
+	revokedKeyPrefix = "session:revoked:"
+)
+
+// RedisStore keeps sessions in Redis so they are shared between server instances
+// and survive restarts. Keys expire together with the session they describe.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store backed by the given Redis client.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// SaveRefreshToken stores the session a refresh token belongs to.
+func (s *RedisStore) SaveRefreshToken(token string, session Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(refreshKeyPrefix+hashToken(token), data, time.Until(session.ExpiresAt)).Err()
+}
+
+// ConsumeRefreshToken removes a refresh token and returns its session. The read and
+// delete run in one transaction so two concurrent refreshes cannot both succeed.
+func (s *RedisStore) ConsumeRefreshToken(token string) (Session, error) {
+	key := refreshKeyPrefix + hashToken(token)
+
+	pipe := s.client.TxPipeline()
+	get := pipe.Get(key)
+	pipe.Del(key)
+	if _, err := pipe.Exec(); err != nil {
+		if err == redis.Nil {
+			return Session{}, ErrNotFound
+		}
+		return Session{}, err
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(get.Val()), &session); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// Revoke marks a session as revoked until the given time.
+func (s *RedisStore) Revoke(sessionID string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(revokedKeyPrefix+sessionID, 1, ttl).Err()
+}
+
+// IsRevoked reports whether a session has been revoked.
+func (s *RedisStore) IsRevoked(sessionID string) (bool, error) {
+	n, err := s.client.Exists(revokedKeyPrefix + sessionID).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
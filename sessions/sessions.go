@@ -0,0 +1,50 @@
+// Package sessions stores login sessions, their rotating refresh tokens and revocations.
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a refresh token is unknown, expired or already used.
+var ErrNotFound = errors.New("session not found")
+
+// Session is a login session. A session outlives individual access and refresh
+// tokens: refreshing rotates the tokens but keeps the session ID.
+type Session struct {
+	ID        string    `json:"id"`
+	PlayerID  uint      `json:"player_id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Store persists refresh tokens and revoked sessions.
+type Store interface {
+	// SaveRefreshToken stores the session a refresh token belongs to until the session expires.
+	SaveRefreshToken(token string, session Session) error
+	// ConsumeRefreshToken removes a refresh token and returns its session. A token can only be consumed once.
+	ConsumeRefreshToken(token string) (Session, error)
+	// Revoke marks a session as revoked until the given time.
+	Revoke(sessionID string, until time.Time) error
+	// IsRevoked reports whether a session has been revoked.
+	IsRevoked(sessionID string) (bool, error)
+}
+
+// NewRefreshToken generates an opaque random refresh token.
+func NewRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken is used so stores never hold refresh tokens in plain text.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
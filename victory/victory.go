@@ -0,0 +1,111 @@
+// Package victory decides when a faction has won a game instance.
+//
+// A victory condition has a type and thresholds encoded as JSON:
+//
+//	Domination: {"zone_share": 0.6}  hold at least this share of the map's zones
+//	Economic:   {"resources": 5000}  hold at least this many resources in total
+//	Military:   {"kills": 300}       destroy at least this many enemy units in combat
+package victory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Condition types, matching the VictoryCondition type enum
+const (
+	Domination = "Domination"
+	Economic   = "Economic"
+	Military   = "Military"
+)
+
+// Types lists every condition type.
+var Types = []string{Domination, Economic, Military}
+
+// Thresholds are the requirements of a victory condition. Only the field belonging to the
+// condition's type is used.
+type Thresholds struct {
+	ZoneShare float64 `json:"zone_share,omitempty"` // Share of the map's zones, above 0 and at most 1
+	Resources int     `json:"resources,omitempty"`
+	Kills     int     `json:"kills,omitempty"`
+}
+
+// Standing is a faction's progress towards victory.
+type Standing struct {
+	FactionID uint
+	ZonesHeld int
+	Resources int
+	Kills     int // Enemy units destroyed in combat
+}
+
+// ErrUnknownType is returned for a condition type that does not exist.
+var ErrUnknownType = errors.New("unknown victory condition type")
+
+// Parse decodes and validates the thresholds of a condition of the given type.
+func Parse(conditionType, details string) (Thresholds, error) {
+	var thresholds Thresholds
+	if err := json.Unmarshal([]byte(details), &thresholds); err != nil {
+		return thresholds, fmt.Errorf("details must be a JSON object: %w", err)
+	}
+
+	switch conditionType {
+	case Domination:
+		if thresholds.ZoneShare <= 0 || thresholds.ZoneShare > 1 {
+			return thresholds, errors.New("zone_share must be above 0 and at most 1")
+		}
+	case Economic:
+		if thresholds.Resources <= 0 {
+			return thresholds, errors.New("resources must be positive")
+		}
+	case Military:
+		if thresholds.Kills <= 0 {
+			return thresholds, errors.New("kills must be positive")
+		}
+	default:
+		return thresholds, ErrUnknownType
+	}
+	return thresholds, nil
+}
+
+// Met reports whether a standing meets a condition on a map of totalZones zones.
+func Met(conditionType string, thresholds Thresholds, standing Standing, totalZones int) bool {
+	switch conditionType {
+	case Domination:
+		return totalZones > 0 && float64(standing.ZonesHeld) >= thresholds.ZoneShare*float64(totalZones)
+	case Economic:
+		return standing.Resources >= thresholds.Resources
+	case Military:
+		return standing.Kills >= thresholds.Kills
+	}
+	return false
+}
+
+// Winner returns the faction that meets a condition, or false if none does. If several
+// do, the one furthest past the threshold wins, then the one listed first.
+func Winner(conditionType string, thresholds Thresholds, standings []Standing, totalZones int) (uint, bool) {
+	var winner uint
+	best, found := 0, false
+	for _, standing := range standings {
+		if !Met(conditionType, thresholds, standing, totalZones) {
+			continue
+		}
+		if score := progress(conditionType, standing); !found || score > best {
+			winner, best, found = standing.FactionID, score, true
+		}
+	}
+	return winner, found
+}
+
+// progress returns the standing's value for the metric a condition type measures.
+func progress(conditionType string, standing Standing) int {
+	switch conditionType {
+	case Domination:
+		return standing.ZonesHeld
+	case Economic:
+		return standing.Resources
+	case Military:
+		return standing.Kills
+	}
+	return 0
+}
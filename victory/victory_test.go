@@ -0,0 +1,112 @@
+package victory
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		conditionType string
+		details       string
+		valid         bool
+	}{
+		{Domination, `{"zone_share": 0.6}`, true},
+		{Domination, `{"zone_share": 1}`, true},
+		{Domination, `{"zone_share": 0}`, false},
+		{Domination, `{"zone_share": 1.5}`, false},
+		{Domination, `{"resources": 100}`, false},
+		{Economic, `{"resources": 5000}`, true},
+		{Economic, `{"resources": -1}`, false},
+		{Military, `{"kills": 300}`, true},
+		{Military, `{}`, false},
+		{Military, `not json`, false},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.conditionType, test.details)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("Parse(%s, %s) error = %v, want valid %v", test.conditionType, test.details, err, test.valid)
+		}
+	}
+
+	if _, err := Parse("Diplomatic", `{}`); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("Parse of an unknown type error = %v, want ErrUnknownType", err)
+	}
+}
+
+func TestMet(t *testing.T) {
+	tests := []struct {
+		name          string
+		conditionType string
+		thresholds    Thresholds
+		standing      Standing
+		totalZones    int
+		met           bool
+	}{
+		{"domination at the share", Domination, Thresholds{ZoneShare: 0.5}, Standing{ZonesHeld: 8}, 16, true},
+		{"domination below the share", Domination, Thresholds{ZoneShare: 0.5}, Standing{ZonesHeld: 7}, 16, false},
+		{"domination without a map", Domination, Thresholds{ZoneShare: 0.5}, Standing{ZonesHeld: 0}, 0, false},
+		{"economic at the threshold", Economic, Thresholds{Resources: 5000}, Standing{Resources: 5000}, 16, true},
+		{"economic below the threshold", Economic, Thresholds{Resources: 5000}, Standing{Resources: 4999}, 16, false},
+		{"military past the threshold", Military, Thresholds{Kills: 300}, Standing{Kills: 450}, 16, true},
+		{"military below the threshold", Military, Thresholds{Kills: 300}, Standing{Kills: 299}, 16, false},
+		{"other thresholds are ignored", Military, Thresholds{Kills: 300, Resources: 1}, Standing{Resources: 10}, 16, false},
+		{"unknown type", "Diplomatic", Thresholds{}, Standing{ZonesHeld: 16}, 16, false},
+	}
+	for _, test := range tests {
+		if met := Met(test.conditionType, test.thresholds, test.standing, test.totalZones); met != test.met {
+			t.Errorf("%s: Met = %v, want %v", test.name, met, test.met)
+		}
+	}
+}
+
+func TestWinner(t *testing.T) {
+	tests := []struct {
+		name          string
+		conditionType string
+		thresholds    Thresholds
+		standings     []Standing
+		winner        uint
+		found         bool
+	}{
+		{
+			name:          "nobody meets the condition",
+			conditionType: Economic, thresholds: Thresholds{Resources: 1000},
+			standings: []Standing{{FactionID: 1, Resources: 999}, {FactionID: 2, Resources: 10}},
+		},
+		{
+			name:          "single faction meets domination",
+			conditionType: Domination, thresholds: Thresholds{ZoneShare: 0.25},
+			standings: []Standing{{FactionID: 1, ZonesHeld: 3}, {FactionID: 2, ZonesHeld: 4}},
+			winner:    2, found: true,
+		},
+		{
+			name:          "furthest past the threshold wins",
+			conditionType: Military, thresholds: Thresholds{Kills: 100},
+			standings: []Standing{{FactionID: 1, Kills: 120}, {FactionID: 2, Kills: 150}, {FactionID: 3, Kills: 90}},
+			winner:    2, found: true,
+		},
+		{
+			name:          "tie goes to the faction listed first",
+			conditionType: Economic, thresholds: Thresholds{Resources: 1000},
+			standings: []Standing{{FactionID: 3, Resources: 500}, {FactionID: 2, Resources: 1200}, {FactionID: 1, Resources: 1200}},
+			winner:    2, found: true,
+		},
+		{
+			name:          "domination tie",
+			conditionType: Domination, thresholds: Thresholds{ZoneShare: 0.5},
+			standings: []Standing{{FactionID: 5, ZonesHeld: 2}, {FactionID: 4, ZonesHeld: 2}},
+			winner:    5, found: true,
+		},
+		{
+			name:          "no standings",
+			conditionType: Military, thresholds: Thresholds{Kills: 1},
+		},
+	}
+	for _, test := range tests {
+		winner, found := Winner(test.conditionType, test.thresholds, test.standings, 4)
+		if winner != test.winner || found != test.found {
+			t.Errorf("%s: Winner = %d, %v, want %d, %v", test.name, winner, found, test.winner, test.found)
+		}
+	}
+}